@@ -0,0 +1,328 @@
+package gadm
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/securecookie"
+	"gopkg.in/guregu/null.v4"
+)
+
+// token purposes, and default lifetime same as Flask-Security
+const (
+	tokenConfirm = "confirm"
+	tokenReset   = "reset"
+
+	confirmWithin = 5 * 24 * time.Hour
+	resetWithin   = 24 * time.Hour
+
+	minPasswordLength = 8
+)
+
+// Payload of signed token. Uniquifier rotates on password change,
+// so a reset token can be used only once.
+type accountToken struct {
+	Id         int
+	Email      string
+	Uniquifier string
+}
+
+// securecookie codec per purpose, key derived from admin key
+func (S *Security) codec(purpose string) *securecookie.SecureCookie {
+	within := emptyOr(S.confirm_within, confirmWithin)
+	if purpose == tokenReset {
+		within = emptyOr(S.reset_within, resetWithin)
+	}
+	sc := securecookie.New(key(string(S.admin.key)+purpose), nil)
+	sc.MaxAge(int(within.Seconds()))
+	return sc
+}
+
+func (S *Security) newToken(purpose string, u *BaseUser) (string, error) {
+	return S.codec(purpose).Encode(purpose,
+		accountToken{Id: u.Id, Email: u.Email, Uniquifier: u.Uniquifier})
+}
+
+// Verify signature and expiration, return the user of token
+func (S *Security) parseToken(purpose, token string) (*BaseUser, error) {
+	var t accountToken
+	if !S.Enabled() {
+		return nil, errors.New(gettext("Invalid link"))
+	}
+	if err := S.codec(purpose).Decode(purpose, token, &t); err != nil {
+		if de, ok := err.(securecookie.Error); ok && de.IsDecode() &&
+			strings.Contains(err.Error(), "expired") {
+			return nil, errors.New(gettext("The link has expired"))
+		}
+		return nil, errors.New(gettext("Invalid link"))
+	}
+
+	var u BaseUser
+	if err := S.db.First(&u, t.Id).Error; err != nil ||
+		u.Email != t.Email || u.Uniquifier != t.Uniquifier {
+		return nil, errors.New(gettext("Invalid link"))
+	}
+	return &u, nil
+}
+
+// Send mails of registration and password reset
+func (S *Security) SetMailer(m Mailer) *Security {
+	S.mailer = m
+	return S
+}
+
+// Lifetime of links in confirmation and password reset mails
+func (S *Security) SetTokenWithin(confirm, reset time.Duration) *Security {
+	S.confirm_within = confirm
+	S.reset_within = reset
+	return S
+}
+
+// Scheme and host of links in mails, like https://admin.example.com.
+// Never taken from the request, a forged Host would poison reset links.
+func (S *Security) SetExternalUrl(base string) *Security {
+	S.external_url = strings.TrimRight(base, "/")
+	return S
+}
+
+// Everyone can register an account at `security.register`.
+// Views without roles are open to every user logged in, registered ones too,
+// so give them SetAccessRoles or SetRequiredRoles.
+func (S *Security) SetRegisterable(v bool) *Security {
+	S.registerable = v
+	return S
+}
+
+// Roles granted to users registered at `security.register`, none by default
+func (S *Security) SetDefaultRoles(roles ...string) *Security {
+	S.default_roles = roles
+	return S
+}
+
+// Users must confirm email before login
+func (S *Security) SetConfirmable(v bool) *Security {
+	S.confirmable = v
+	return S
+}
+
+// absolute url of endpoint, for links in mail
+func (S *Security) externalUrl(endpoint string, args ...any) (string, error) {
+	if S.external_url == "" {
+		return "", errors.New("external url is not set")
+	}
+	return S.external_url + must(S.Blueprint.GetUrl(endpoint, args...)), nil
+}
+
+func (S *Security) sendMail(to, subject, body string) error {
+	if S.mailer == nil {
+		return errors.New("mailer is not set")
+	}
+	return S.mailer.Send(&Mail{To: []string{to}, Subject: subject, Body: body})
+}
+
+func (S *Security) sendConfirmation(u *BaseUser) error {
+	token, err := S.newToken(tokenConfirm, u)
+	if err != nil {
+		return err
+	}
+	link, err := S.externalUrl("security.confirm", "token", token)
+	if err != nil {
+		return err
+	}
+	return S.sendMail(u.Email, gettext("Please confirm your email"),
+		gettext("Please confirm your email through the link below:\n\n%s\n", link))
+}
+
+func (S *Security) sendReset(u *BaseUser) error {
+	token, err := S.newToken(tokenReset, u)
+	if err != nil {
+		return err
+	}
+	link, err := S.externalUrl("security.reset_password", "token", token)
+	if err != nil {
+		return err
+	}
+	return S.sendMail(u.Email, gettext("Password reset instructions"),
+		gettext("Click the link below to reset your password:\n\n%s\n\nIf you did not request this, ignore this mail.\n", link))
+}
+
+func checkPassword(password, confirm string) error {
+	if len(password) < minPasswordLength {
+		return errors.New(gettext("Password must be at least %d characters", minPasswordLength))
+	}
+	if password != confirm {
+		return errors.New(gettext("Passwords do not match"))
+	}
+	return nil
+}
+
+func (S *Security) renderAccount(w http.ResponseWriter, r *http.Request, tmpl string, m map[string]any) {
+	m["csrf_field"] = csrf.TemplateField(r)
+	m["login_url"] = must(S.Blueprint.GetUrl("security.login"))
+	S.Render(w, r, tmpl, nil, m)
+}
+
+func (S *Security) validateRegister(email, password, confirm string) error {
+	if _, err := mail.ParseAddress(email); err != nil || strings.ContainsAny(email, "<> ") {
+		return errors.New(gettext("Invalid email address"))
+	}
+	if err := checkPassword(password, confirm); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (S *Security) registerHandler(w http.ResponseWriter, r *http.Request) {
+	if !S.Enabled() || !S.registerable {
+		http.NotFound(w, r)
+		return
+	}
+
+	var err error
+	email := strings.TrimSpace(r.PostFormValue("email"))
+	if r.Method == http.MethodPost {
+		password := r.PostFormValue("password")
+		err = S.validateRegister(email, password, r.PostFormValue("password_confirm"))
+
+		// same response whether the account exists or not
+		taken := err == nil && S.db.Where("email = ?", email).First(&BaseUser{}).Error == nil
+		var u *BaseUser
+		if err == nil && !taken {
+			u, err = S.CreateUser(email, password)
+			if err == nil {
+				err = S.AddRoles(u, S.default_roles...)
+			}
+		}
+		if err == nil && !taken && !S.confirmable {
+			S.login(r, u)
+			http.Redirect(w, r, must(S.Blueprint.GetUrl("admin.index")), http.StatusFound)
+			return
+		}
+		if err == nil {
+			if !taken {
+				if err := S.sendConfirmation(u); err != nil {
+					log.Print(err)
+				}
+			}
+			S.AddFlash(r, FlashSuccess(gettext("Thank you. Confirmation instructions have been sent to %s.", email)))
+			http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	S.renderAccount(w, r, "templates/register.gotmpl", map[string]any{
+		"name":  gettext("Register"),
+		"email": email,
+		"error": err,
+	})
+}
+
+// Resend confirmation mail
+func (S *Security) sendConfirmationHandler(w http.ResponseWriter, r *http.Request) {
+	if !S.Enabled() || !S.confirmable {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		var u BaseUser
+		// same response whether the account exists or not
+		if S.db.Where("email = ?", email).First(&u).Error == nil && !u.ConfirmedAt.Valid {
+			if err := S.sendConfirmation(&u); err != nil {
+				log.Print(err)
+			}
+		}
+		S.AddFlash(r, FlashInfo(gettext("Confirmation instructions have been sent to %s if the account exists.", email)))
+		http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+		return
+	}
+
+	S.renderAccount(w, r, "templates/send_confirmation.gotmpl", map[string]any{
+		"name": gettext("Resend confirmation instructions"),
+	})
+}
+
+// GET ?token=, link in confirmation mail
+func (S *Security) confirmHandler(w http.ResponseWriter, r *http.Request) {
+	login := must(S.Blueprint.GetUrl("security.login"))
+	u, err := S.parseToken(tokenConfirm, r.FormValue("token"))
+	switch {
+	case err != nil:
+		S.AddFlash(r, FlashError(err))
+		login = must(S.Blueprint.GetUrl("security.send_confirmation"))
+	case u.ConfirmedAt.Valid:
+		S.AddFlash(r, FlashInfo(gettext("Your email has already been confirmed.")))
+	default:
+		if err = S.db.Model(u).Update("confirmed_at", null.TimeFrom(time.Now())).Error; err != nil {
+			S.AddFlash(r, FlashError(err))
+		} else {
+			S.AddFlash(r, FlashSuccess(gettext("Thank you. Your email has been confirmed.")))
+		}
+	}
+	http.Redirect(w, r, login, http.StatusFound)
+}
+
+func (S *Security) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if !S.Enabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		email := strings.TrimSpace(r.PostFormValue("email"))
+		var u BaseUser
+		if S.db.Where("email = ?", email).First(&u).Error == nil && u.Active {
+			if err := S.sendReset(&u); err != nil {
+				log.Print(err)
+			}
+		}
+		S.AddFlash(r, FlashInfo(gettext("Instructions to reset your password have been sent to %s if the account exists.", email)))
+		http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+		return
+	}
+
+	S.renderAccount(w, r, "templates/forgot_password.gotmpl", map[string]any{
+		"name": gettext("Forgot password"),
+	})
+}
+
+// GET/POST ?token=, link in reset mail
+func (S *Security) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	u, err := S.parseToken(tokenReset, token)
+	if err != nil {
+		S.AddFlash(r, FlashError(err))
+		http.Redirect(w, r, must(S.Blueprint.GetUrl("security.forgot_password")), http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		password := r.PostFormValue("password")
+		if err = checkPassword(password, r.PostFormValue("password_confirm")); err == nil {
+			if err = S.SetPassword(u, password); err == nil {
+				// the mail proved the ownership
+				if !u.ConfirmedAt.Valid {
+					S.db.Model(u).Update("confirmed_at", null.TimeFrom(time.Now()))
+				}
+				S.AddFlash(r, FlashSuccess(gettext("You successfully reset your password, please log in.")))
+				http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	S.renderAccount(w, r, "templates/reset_password.gotmpl", map[string]any{
+		"name":  gettext("Reset password"),
+		"token": token,
+		"error": err,
+		"email": u.Email,
+	})
+}
@@ -0,0 +1,189 @@
+package gadm
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var linkPattern = regexp.MustCompile(`http://example.com(/\S+)`)
+
+// local path of the link in last mail
+func lastLink(o *Outbox) string {
+	if m := o.Last(); m != nil {
+		if ms := linkPattern.FindStringSubmatch(m.Body); ms != nil {
+			return ms[1]
+		}
+	}
+	return ""
+}
+
+func TestOutbox(t *testing.T) {
+	is := assert.New(t)
+
+	dir := t.TempDir()
+	o := NewOutbox(dir)
+	is.Nil(o.Last())
+	is.Nil(o.Send(&Mail{To: []string{"a@example.com"}, Subject: "Hi\r\nBcc: x@evil.com", Body: "line1\nline2"}))
+	is.Len(o.Mails(), 1)
+	is.Equal("admin@localhost", o.Last().From)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	is.Len(files, 1)
+	bs, _ := os.ReadFile(files[0])
+	is.Contains(string(bs), "To: a@example.com\r\n")
+	is.NotContains(string(bs), "\r\nBcc:")
+	is.Contains(string(bs), "\r\n\r\nline1\r\nline2")
+}
+
+func TestRegister(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	outbox := NewOutbox("")
+	admin.Security().SetMailer(outbox).SetExternalUrl("http://example.com/")
+
+	c := newTestClient(admin)
+	is.Equal(404, c.do("GET", "/admin/register", nil).Code)
+
+	admin.Security().SetRegisterable(true).SetConfirmable(true)
+	is.Contains(c.do("GET", "/admin/login", nil).Body.String(), `href="/admin/register"`)
+
+	form := url.Values{"email": {"alice@example.com"}, "password": {"secret"}, "password_confirm": {"secret"}}
+	is.Equal(400, c.post("/admin/register", "/admin/register", form).Code)
+	form.Set("password", "secret123")
+	is.Equal(400, c.post("/admin/register", "/admin/register", form).Code)
+	form.Set("password_confirm", "secret123")
+	w := c.post("/admin/register", "/admin/register", form)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/login", w.Header().Get("location"))
+	is.Equal([]string{"alice@example.com"}, outbox.Last().To)
+
+	// taken, same response without mail
+	w = c.post("/admin/register", "/admin/register", form)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/login", w.Header().Get("location"))
+	is.Contains(c.do("GET", "/admin/login", nil).Body.String(), "Confirmation instructions have been sent to alice@example.com.")
+	is.Len(outbox.Mails(), 1)
+
+	// not confirmed
+	login := url.Values{"email": {"alice@example.com"}, "password": {"secret123"}}
+	w = c.post("/admin/login", "/admin/login", login)
+	is.Equal(401, w.Code)
+	is.Contains(w.Body.String(), "Email requires confirmation.")
+
+	// resend
+	is.Equal(302, c.post("/admin/send_confirmation", "/admin/send_confirmation",
+		url.Values{"email": {"alice@example.com"}}).Code)
+	is.Len(outbox.Mails(), 2)
+	is.Equal(302, c.post("/admin/send_confirmation", "/admin/send_confirmation",
+		url.Values{"email": {"nobody@example.com"}}).Code)
+	is.Len(outbox.Mails(), 2)
+
+	link := lastLink(outbox)
+	is.Contains(link, "/admin/confirm?token=")
+	is.Equal("/admin/send_confirmation", c.do("GET", "/admin/confirm?token=bad", nil).Header().Get("location"))
+	w = c.do("GET", link, nil)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/login", w.Header().Get("location"))
+
+	var u BaseUser
+	db.First(&u, "email = ?", "alice@example.com")
+	is.True(u.ConfirmedAt.Valid)
+	is.Equal(302, c.post("/admin/login", "/admin/login", login).Code)
+	is.Equal(200, c.do("GET", "/admin/", nil).Code)
+}
+
+func TestRegisterRoles(t *testing.T) {
+	is := assert.New(t)
+
+	admin, _ := newSecureAdmin(t)
+	rv := NewView(Menu{Name: "Report", Category: "Other"})
+	rv.Blueprint = &Blueprint{Endpoint: "report", Path: "/report"}
+	rv.Expose("/", func(w http.ResponseWriter, r *http.Request) {})
+	admin.AddView(rv.SetAccessRoles("staff"))
+	admin.Security().SetRegisterable(true)
+
+	register := func(email string) *testClient {
+		c := newTestClient(admin)
+		w := c.post("/admin/register", "/admin/register", url.Values{
+			"email": {email}, "password": {"secret123"}, "password_confirm": {"secret123"}})
+		is.Equal(302, w.Code)
+		is.Equal("/admin/", w.Header().Get("location"))
+		return c
+	}
+
+	// no roles by default
+	is.Equal(403, register("alice@example.com").do("GET", "/admin/report/", nil).Code)
+
+	admin.Security().SetDefaultRoles("staff")
+	is.Equal(200, register("bob@example.com").do("GET", "/admin/report/", nil).Code)
+}
+
+func TestResetPassword(t *testing.T) {
+	is := assert.New(t)
+
+	admin, _ := newSecureAdmin(t)
+	outbox := NewOutbox("")
+	admin.Security().SetMailer(outbox)
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	// no link without external url, nor error telling the account exists
+	c := newTestClient(admin)
+	w := c.post("/admin/forgot_password", "/admin/forgot_password", url.Values{"email": {"alice@example.com"}})
+	is.Equal(302, w.Code)
+	is.Nil(outbox.Last())
+	is.NotContains(c.do("GET", "/admin/login", nil).Body.String(), "external url")
+
+	// link of external url, not of forged host
+	admin.Security().SetExternalUrl("http://example.com")
+	page := c.do("GET", "/admin/forgot_password", nil)
+	form := url.Values{"email": {"alice@example.com"}, "csrf_token": {html.UnescapeString(csrfPattern.FindStringSubmatch(page.Body.String())[1])}}
+	r := httptest.NewRequest("POST", "/admin/forgot_password", strings.NewReader(form.Encode()))
+	r.Host = "evil.com"
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	is.Equal(302, w.Code)
+	is.NotContains(outbox.Last().Body, "evil.com")
+	link := lastLink(outbox)
+	is.Contains(link, "/admin/reset_password?token=")
+
+	is.Equal(200, c.do("GET", link, nil).Code)
+	w = c.post(link, link, url.Values{"password": {"newsecret1"}, "password_confirm": {"newsecret2"}})
+	is.Equal(400, w.Code)
+	w = c.post(link, link, url.Values{"password": {"newsecret1"}, "password_confirm": {"newsecret1"}})
+	is.Equal(302, w.Code)
+
+	// used once
+	is.Equal("/admin/forgot_password", c.do("GET", link, nil).Header().Get("location"))
+
+	w = c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"newsecret1"}})
+	is.Equal(302, w.Code)
+
+	// expired
+	u, _ := admin.Security().CreateUser("bob@example.com", "secret")
+	token, _ := admin.Security().newToken(tokenReset, u)
+	_, err := admin.Security().parseToken(tokenReset, token)
+	is.Nil(err)
+	_, err = admin.Security().parseToken(tokenConfirm, token)
+	is.NotNil(err, "another purpose")
+
+	admin.Security().SetTokenWithin(time.Second, time.Second)
+	time.Sleep(2100 * time.Millisecond)
+	_, err = admin.Security().parseToken(tokenReset, token)
+	is.EqualError(err, "The link has expired")
+}
@@ -3,6 +3,7 @@ package gadm
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gadm/isdebug"
 	"html/template"
@@ -40,6 +41,7 @@ func NewAdmin(name string) *Admin {
 		dbs:         map[string]*gorm.DB{},
 		debug:       isdebug.On,
 		autoMigrate: true,
+		maxBodySize: 32 << 20,
 		trace:       true,
 		tracer:      NewTrace(),
 		key:         key,
@@ -68,7 +70,10 @@ func NewAdmin(name string) *Admin {
 			"trace":      {Endpoint: "trace", Path: "/trace", Handler: A.traceHandler},
 			"theme":      {Endpoint: "theme", Path: "/theme", Handler: A.themeHandler},
 			"ping":       {Endpoint: "ping", Path: "/ping", Handler: A.pingHandler},
-			"static":     {Endpoint: "static", Path: "/static/", StaticFolder: "static"},
+			// rest api of views
+			"openapi":      {Endpoint: "openapi", Path: "/openapi.json", Handler: A.openapiHandler},
+			"openapi_view": {Endpoint: "openapi_view", Path: "/openapi", Handler: A.openapiHtmlHandler},
+			"static":       {Endpoint: "static", Path: "/static/", StaticFolder: "static"},
 		}}
 
 	A.Blueprint.registerTo(A.mux, "")
@@ -77,6 +82,7 @@ func NewAdmin(name string) *Admin {
 	gotext.Configure("translations", "en", "admin")
 
 	A.security = AddSecurity(A)
+	A.audit = &Audit{admin: A}
 	return A
 }
 
@@ -87,6 +93,7 @@ type Admin struct {
 
 	debug             bool
 	autoMigrate       bool
+	maxBodySize       int64
 	trace             bool
 	tracer            *Trace
 	key               []byte
@@ -97,6 +104,7 @@ type Admin struct {
 	indexTemplateFile string
 	theme             string
 	security          *Security
+	audit             *Audit
 }
 
 func (A *Admin) Session(r *http.Request) *sessions.Session {
@@ -108,6 +116,8 @@ func (A *Admin) Session(r *http.Request) *sessions.Session {
 	return sess
 }
 
+func (A *Admin) Security() *Security { return A.security }
+
 func (A *Admin) Register(b *Blueprint) {
 	if err := A.Blueprint.AddChild(b); err != nil {
 		log.Print(err)
@@ -122,6 +132,7 @@ func (A *Admin) AddView(view View) View {
 
 	if b := view.GetBlueprint(); b != nil {
 		A.views = append(A.views, view)
+		A.guard(view, b)
 		A.Register(b)
 
 		A.addViewToMenu(view)
@@ -152,8 +163,26 @@ func (A *Admin) FindView(endpoint string) View {
 	return v
 }
 
+// Check `View.IsAccessible` before every handler of the view
+func (A *Admin) guard(view View, b *Blueprint) {
+	if h := b.Handler; h != nil {
+		b.Handler = func(w http.ResponseWriter, r *http.Request) {
+			if !view.IsAccessible(r) {
+				http.Error(w, gettext("You don't have the permission to access the requested resource."),
+					http.StatusForbidden)
+				return
+			}
+			h(w, r)
+		}
+	}
+	for _, c := range b.Children {
+		A.guard(view, c)
+	}
+}
+
 func (A *Admin) addViewToMenu(view View) {
 	if menu := view.GetMenu(); menu != nil {
+		menu.view = view
 		// CAUTION: patch MenuItem.Path
 		if menu.Path == "" {
 			menu.Path, _ = A.Blueprint.GetUrl(view.GetBlueprint().Endpoint + ".index")
@@ -212,13 +241,36 @@ func (A *Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// for http
 	r = csrf.PlaintextHTTPRequest(r)
 
+	// parsed here for csrf token, or the whole upload is read by csrf
+	r.Body = http.MaxBytesReader(w, r.Body, A.maxBodySize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		if mbe := (*http.MaxBytesError)(nil); errors.As(err, &mbe) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
 	// make sure session put in r.Context
 	_ = sessions.GetRegistry(r)
 
+	// current user, of bearer token without csrf, or of session
+	r, err := A.security.authenticateToken(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		replyError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if apiTokenOf(r) == nil {
+		r = A.security.authenticate(r)
+	} else if !A.isTokenPath(r.URL.Path) {
+		replyError(w, http.StatusForbidden, errors.New("bearer token is only accepted by the REST API"))
+		return
+	}
+
 	cw := NewCachedWriter(w)
-	// csrf protect
+	// csrf protect, then login required
 	handlers.LoggingHandler(os.Stdout,
-		A.csrf(A.mux)).ServeHTTP(cw, r)
+		A.csrf(A.security.protect(A.mux))).ServeHTTP(cw, r)
 
 	// save sesstion before flush
 	if err := sessions.Save(r, cw); err != nil {
@@ -271,7 +323,7 @@ var themes = []string{
 	// "sandstone", "simplex", "sketchy", "spacelab", "yeti",
 }
 
-func (A *Admin) dict(others ...map[string]any) map[string]any {
+func (A *Admin) dict(r *http.Request, others ...map[string]any) map[string]any {
 	o := map[string]any{
 		"debug":    A.debug,
 		"security": A.security,
@@ -280,7 +332,7 @@ func (A *Admin) dict(others ...map[string]any) map[string]any {
 		"url":      A.Blueprint.Path, // "/admin"
 		// 'swatch' from flask-admin
 		"swatch": A.theme,
-		"menu":   A.BaseView.Menu,
+		"menu":   A.BaseView.Menu.visible(r),
 		"config": config,
 	}
 
@@ -291,7 +343,7 @@ func (A *Admin) dict(others ...map[string]any) map[string]any {
 }
 
 func (A *Admin) indexHandler(w http.ResponseWriter, r *http.Request) {
-	A.Render(w, r, A.indexTemplateFile, nil, A.dict())
+	A.Render(w, r, A.indexTemplateFile, nil, A.dict(r))
 }
 func (A *Admin) pingHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("ping"))
@@ -302,7 +354,7 @@ func (A *Admin) debugHandler(w http.ResponseWriter, r *http.Request) {
 		panic("not found PlaintextHTTPContextKey")
 	}
 
-	ReplyJson(w, 200, A.dict(map[string]any{
+	ReplyJson(w, 200, A.dict(r, map[string]any{
 		"blueprint": A.Blueprint.dict(),
 	}))
 }
@@ -318,7 +370,7 @@ func (A *Admin) debugHtmlHandler(w http.ResponseWriter, r *http.Request) {
 		panic(err)
 	}
 
-	err = tx.Lookup("debug.gotmpl").Execute(w, A.dict())
+	err = tx.Lookup("debug.gotmpl").Execute(w, A.dict(r))
 	if err != nil {
 		w.Write([]byte(err.Error()))
 	}
@@ -369,6 +421,11 @@ func (A *Admin) SetIndexTemplateFile(nfn string) {
 	A.indexTemplateFile = nfn
 }
 
+// Largest request body, like uploaded file of import. 32 MB by default
+func (A *Admin) SetMaxBodySize(n int64) {
+	A.maxBodySize = n
+}
+
 type wsWriter struct {
 	*websocket.Conn
 }
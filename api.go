@@ -0,0 +1,217 @@
+package gadm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/csrf"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+)
+
+// REST api of model, same permissions, validators and hooks as the forms.
+//
+//	GET    /api       list, with page, page_size, sort, desc, search and flt of Query
+//	POST   /api       create, json object by column
+//	GET    /api/{id}  one by primary key, pk1,pk2 when composite
+//	PATCH  /api/{id}  update the given columns, null clears a nullable one
+//	DELETE /api/{id}  delete
+func (V *ModelView) SetApi(v bool) *ModelView {
+	V.can_api = v
+	return V
+}
+
+// Paths of rest api, anonymous request is not redirected to login
+func isApiPath(path string) bool {
+	return strings.HasSuffix(path, "/api") || strings.Contains(path, "/api/")
+}
+
+func replyError(w http.ResponseWriter, status int, err error) {
+	ReplyJson(w, status, map[string]any{"error": err.Error()})
+}
+
+func (V *ModelView) apiHandler(w http.ResponseWriter, r *http.Request) {
+	if !V.can_api {
+		replyError(w, http.StatusNotFound, errors.New(http.StatusText(http.StatusNotFound)))
+		return
+	}
+	// for session clients, to send with X-CSRF-Token
+	w.Header().Set("X-CSRF-Token", csrf.Token(r))
+
+	rowid := r.PathValue("id")
+	allowed := []string{http.MethodGet, http.MethodPatch, http.MethodDelete}
+	if rowid == "" {
+		allowed = []string{http.MethodGet, http.MethodPost}
+	}
+	if !slices.Contains(allowed, r.Method) {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		replyError(w, http.StatusMethodNotAllowed, errors.New(http.StatusText(http.StatusMethodNotAllowed)))
+		return
+	}
+	p := map[string]Permission{
+		http.MethodGet:    PermList,
+		http.MethodPost:   PermCreate,
+		http.MethodPatch:  PermEdit,
+		http.MethodDelete: PermDelete,
+	}[r.Method]
+	if !V.can(r, p) {
+		replyError(w, http.StatusForbidden, errors.New(gettext("Permission denied.")))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && rowid == "":
+		V.apiList(w, r)
+	case r.Method == http.MethodGet:
+		V.apiGet(w, r, rowid, http.StatusOK)
+	case r.Method == http.MethodPost:
+		V.apiCreate(w, r)
+	case r.Method == http.MethodPatch:
+		V.apiUpdate(w, r, rowid)
+	case r.Method == http.MethodDelete:
+		V.apiDelete(w, r, rowid)
+	}
+}
+
+func (V *ModelView) apiList(w http.ResponseWriter, r *http.Request) {
+	q := V.queryFrom(r)
+	res := V.list(q)
+	if res.Error != nil {
+		replyError(w, http.StatusBadRequest, res.Error)
+		return
+	}
+	ReplyJson(w, http.StatusOK, map[string]any{
+		"total":     res.Total,
+		"page":      q.Page,
+		"page_size": q.PageSize,
+		"data":      res.Rows,
+	})
+}
+
+func (V *ModelView) apiGet(w http.ResponseWriter, r *http.Request, rowid string, status int) {
+	row, err := V.getOne(r, rowid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		replyError(w, http.StatusNotFound, errors.New(gettext("Record does not exist.")))
+		return
+	} else if err != nil {
+		replyError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ReplyJson(w, status, row)
+}
+
+func (V *ModelView) apiCreate(w http.ResponseWriter, r *http.Request) {
+	row, errs, err := V.apiRow(r, V.fsNew, true)
+	if err != nil {
+		replyError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(errs) > 0 {
+		ReplyJson(w, http.StatusBadRequest, map[string]any{"error": errs.String(), "errors": errs})
+		return
+	}
+
+	if err := V.create(r.Context(), row); err != nil {
+		replyError(w, http.StatusInternalServerError, err)
+		return
+	}
+	rowid := V.pkOf(row.Map)
+	w.Header().Set("Location", must(V.Blueprint.GetUrl(".api"))+"/"+url.PathEscape(rowid))
+	V.apiGet(w, r, rowid, http.StatusCreated)
+}
+
+func (V *ModelView) apiUpdate(w http.ResponseWriter, r *http.Request, rowid string) {
+	if _, err := V.getOne(r, rowid); err != nil {
+		replyError(w, http.StatusNotFound, errors.New(gettext("Record does not exist.")))
+		return
+	}
+	row, errs, err := V.apiRow(r, V.fsEdit, false)
+	if err != nil {
+		replyError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(errs) > 0 {
+		ReplyJson(w, http.StatusBadRequest, map[string]any{"error": errs.String(), "errors": errs})
+		return
+	}
+
+	if err := V.update(r.Context(), rowid, row); err != nil {
+		replyError(w, http.StatusInternalServerError, err)
+		return
+	}
+	V.apiGet(w, r, rowid, http.StatusOK)
+}
+
+func (V *ModelView) apiDelete(w http.ResponseWriter, r *http.Request, rowid string) {
+	if _, err := V.getOne(r, rowid); err != nil {
+		replyError(w, http.StatusNotFound, errors.New(gettext("Record does not exist.")))
+		return
+	}
+	if err := V.deleteOne(r.Context(), rowid); err != nil {
+		replyError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Validated row of request body.
+// json null is NULL of nullable column, and an error of others.
+func (V *ModelView) apiRow(r *http.Request, fields []*Field, creating bool) (*Row, formErrors, error) {
+	uv, nulls, err := apiValues(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	errs := V.validate(uv, fields, creating)
+	row := V.intoRow(uv, fields)
+	for _, name := range nulls {
+		f, ok := lo.Find(fields, func(f *Field) bool { return f.DBName == name })
+		if !ok || f.Readonly || f.Hidden || len(errs[name]) > 0 {
+			continue
+		}
+		if !nullable(f) {
+			errs.add(name, gettext("This field cannot be null."))
+			continue
+		}
+		row.Set(f, nil)
+	}
+	return row, errs, nil
+}
+
+// Body of json object or form into values of form, and columns of null.
+// Array is joined by comma for many to many.
+func apiValues(r *http.Request) (url.Values, []string, error) {
+	if !strings.Contains(r.Header.Get("content-type"), "json") {
+		if err := r.ParseForm(); err != nil {
+			return nil, nil, err
+		}
+		return r.PostForm, nil, nil
+	}
+
+	var m map[string]any
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("invalid json: %w", err)
+	}
+	uv := url.Values{}
+	nulls := []string{}
+	for k, v := range m {
+		switch v := v.(type) {
+		case nil:
+			nulls = append(nulls, k)
+		case []any:
+			uv.Set(k, strings.Join(cast.ToStringSlice(v), ","))
+		case json.Number:
+			uv.Set(k, v.String())
+		default:
+			uv.Set(k, cast.ToString(v))
+		}
+	}
+	return uv, nulls, nil
+}
@@ -0,0 +1,164 @@
+package gadm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v4"
+)
+
+// request with json body, csrf token from the header of api
+func (c *testClient) json(method, path, body string) *httptest.ResponseRecorder {
+	token := c.do("GET", path[:strings.LastIndex(path, "/api")+4], nil).Header().Get("X-CSRF-Token")
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("X-CSRF-Token", token)
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, r)
+	return w
+}
+
+func TestApi(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	admin.AddView(NewModelView(Gadget{}, db).
+		SetApi(true).
+		SetColumnSearchableList("name").
+		SetRequiredRoles(PermDelete, "admin").
+		OnModelChange(func(ctx context.Context, row *Row, created bool) error {
+			if row.Get("code") == "CLOSED" {
+				return errors.New("Record is closed.")
+			}
+			return nil
+		}))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&[]Gadget{{Name: "Gear", Stock: 2, Price: 1.5}, {Name: "Cog"}})
+
+	c := newTestClient(admin)
+	// anonymous
+	w := c.do("GET", "/admin/gadget/api", nil)
+	is.Equal(401, w.Code)
+	is.Equal(ContentTypeJson, w.Header().Get("content-type"))
+
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w = c.do("GET", "/admin/gadget/api?search=gear", nil)
+	is.Equal(200, w.Code)
+	is.JSONEq(`{"total": 1, "page": 0, "page_size": 20, "data": [
+		{"id": 1, "name": "Gear", "stock": 2, "price": 1.5, "code": ""}]}`, w.Body.String())
+
+	// list of the page in the same shape, Fields and Map of Row are not encodable
+	w = c.do("GET", "/admin/gadget/list?search=gear", nil)
+	is.Equal(200, w.Code)
+	is.JSONEq(`{"total": 1, "data": [
+		{"id": 1, "name": "Gear", "stock": 2, "price": 1.5, "code": ""}]}`, w.Body.String())
+
+	w = c.do("GET", "/admin/gadget/api?sort=1&page_size=1", nil)
+	var list struct {
+		Total int64
+		Data  []map[string]any
+	}
+	is.Nil(json.Unmarshal(w.Body.Bytes(), &list))
+	is.Equal(int64(2), list.Total)
+	is.Equal("Cog", list.Data[0]["name"])
+
+	is.Equal(200, c.do("GET", "/admin/gadget/api/2", nil).Code)
+	is.Equal(404, c.do("GET", "/admin/gadget/api/9", nil).Code)
+
+	// create
+	w = c.json("POST", "/admin/gadget/api", `{"name": "Wheel", "stock": 3, "price": 2.25}`)
+	is.Equal(201, w.Code)
+	is.Equal("/admin/gadget/api/3", w.Header().Get("Location"))
+	is.JSONEq(`{"id": 3, "name": "Wheel", "stock": 3, "price": 2.25, "code": ""}`, w.Body.String())
+
+	w = c.json("POST", "/admin/gadget/api", `{"stock": "many"}`)
+	is.Equal(400, w.Code)
+	is.JSONEq(`{"error": "name: This field is required.", "errors": {
+		"name": ["This field is required."], "stock": ["Not a valid integer value."]}}`, w.Body.String())
+	is.Equal(400, c.json("POST", "/admin/gadget/api", `[1`).Code)
+
+	// update
+	w = c.json("PATCH", "/admin/gadget/api/3", `{"stock": 7}`)
+	is.Equal(200, w.Code)
+	is.JSONEq(`{"id": 3, "name": "Wheel", "stock": 7, "price": 2.25, "code": ""}`, w.Body.String())
+	is.Equal(404, c.json("PATCH", "/admin/gadget/api/9", `{"stock": 7}`).Code)
+	w = c.json("PATCH", "/admin/gadget/api/3", `{"code": "CLOSED"}`)
+	is.Equal(500, w.Code)
+	is.JSONEq(`{"error": "Record is closed."}`, w.Body.String())
+
+	// methods, csrf and permissions
+	is.Equal(405, c.json("DELETE", "/admin/gadget/api", ``).Code)
+	is.Equal("GET, POST", c.json("PUT", "/admin/gadget/api", ``).Header().Get("Allow"))
+	is.Equal(403, c.do("DELETE", "/admin/gadget/api/3", nil).Code, "without csrf token")
+	is.Equal(403, c.json("DELETE", "/admin/gadget/api/3", ``).Code)
+
+	u, _ := admin.Security().CreateUser("root@example.com", "secret")
+	admin.Security().AddRoles(u, "admin")
+	c = newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"root@example.com"}, "password": {"secret"}})
+	is.Equal(204, c.json("DELETE", "/admin/gadget/api/3", ``).Code)
+	is.Equal(404, c.json("DELETE", "/admin/gadget/api/3", ``).Code)
+
+	// opt-in
+	admin2, db2 := newSecureAdmin(t)
+	admin2.AddView(NewModelView(Gadget{}, db2))
+	admin2.freeze()
+	admin2.Security().CreateUser("alice@example.com", "secret")
+	c = newTestClient(admin2)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	is.Equal(404, c.do("GET", "/admin/gadget/api", nil).Code)
+}
+
+type Part struct {
+	Id     uint
+	Name   string `gorm:"not null"`
+	Stock  int
+	Weight null.Float
+}
+
+func TestApiNull(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Part{})
+	admin.AddView(NewModelView(Part{}, db).SetApi(true))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w := c.json("POST", "/admin/part/api", `{"name": "Bolt", "stock": 2, "weight": 1.5}`)
+	is.Equal(201, w.Code, w.Body.String())
+
+	// nullable column is cleared
+	w = c.json("PATCH", "/admin/part/api/1", `{"weight": null}`)
+	is.Equal(200, w.Code)
+	is.JSONEq(`{"id": 1, "name": "Bolt", "stock": 2, "weight": null}`, w.Body.String())
+	var p Part
+	db.First(&p, 1)
+	is.False(p.Weight.Valid)
+
+	// null is not zero or empty of others
+	w = c.json("PATCH", "/admin/part/api/1", `{"stock": null, "name": null}`)
+	is.Equal(400, w.Code)
+	is.JSONEq(`{"error": "name: This field cannot be null.", "errors": {
+		"name": ["This field cannot be null."], "stock": ["This field cannot be null."]}}`, w.Body.String())
+	w = c.json("POST", "/admin/part/api", `{"name": null, "weight": null}`)
+	is.Equal(400, w.Code)
+	is.JSONEq(`{"error": "name: This field is required.", "errors": {"name": ["This field is required."]}}`, w.Body.String())
+	db.First(&p, 1)
+	is.Equal(2, p.Stock)
+	is.Equal("Bolt", p.Name)
+}
@@ -0,0 +1,184 @@
+package gadm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Personal token of user for programmatic access, in header `Authorization: Bearer <token>`.
+// Only sha256 of the token is stored, the token is shown once when created.
+type ApiToken struct {
+	Id     int    `gorm:"primaryKey"`
+	UserId int    `gorm:"index;not null"`
+	Name   string `gorm:"size:64"`
+	Hash   string `gorm:"uniqueIndex;not null;size:64"`
+	// first characters, to tell tokens apart
+	Prefix string `gorm:"size:16"`
+	// permissions allowed by token, comma separated
+	Scopes     string `gorm:"size:255"`
+	ExpiresAt  null.Time
+	CreatedAt  time.Time
+	LastUsedAt null.Time
+}
+
+// Scopes of token, the permissions of model views
+var apiScopes = []Permission{PermList, PermCreate, PermEdit, PermDelete, PermExport}
+
+const apiTokenPrefix = "gadm_"
+
+type tokenKey struct{}
+
+// Actions of views change records, allowed by edit scope
+func (t *ApiToken) allows(perm Permission) bool {
+	if !slices.Contains(apiScopes, perm) {
+		perm = PermEdit
+	}
+	return slices.Contains(strings.Split(t.Scopes, ","), string(perm))
+}
+
+func (t *ApiToken) Expired(now time.Time) bool {
+	return t.ExpiresAt.Valid && !now.Before(t.ExpiresAt.Time)
+}
+
+func hashApiToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Token of the request, nil for session
+func apiTokenOf(r *http.Request) *ApiToken {
+	t, _ := r.Context().Value(tokenKey{}).(*ApiToken)
+	return t
+}
+
+// Create token of user, returns the plain token
+func (S *Security) CreateApiToken(u *BaseUser, name string, scopes []Permission, expires time.Duration) (string, *ApiToken, error) {
+	scopes = slices.DeleteFunc(slices.Clone(scopes), func(p Permission) bool {
+		return !slices.Contains(apiScopes, p)
+	})
+	if len(scopes) == 0 {
+		return "", nil, errors.New(gettext("Select at least one scope."))
+	}
+
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		return "", nil, err
+	}
+	token := apiTokenPrefix + b64url.EncodeToString(bs)
+	t := &ApiToken{
+		UserId: u.Id,
+		Name:   name[:min(len(name), 64)],
+		Hash:   hashApiToken(token),
+		Prefix: token[:len(apiTokenPrefix)+6],
+		Scopes: strings.Join(lo.Map(scopes, func(p Permission, _ int) string { return string(p) }), ","),
+	}
+	if expires > 0 {
+		t.ExpiresAt = null.TimeFrom(time.Now().Add(expires))
+	}
+	if err := S.db.Create(t).Error; err != nil {
+		return "", nil, err
+	}
+	return token, t, nil
+}
+
+// Load user of bearer token into request context.
+// Error for invalid, expired or revoked token.
+func (S *Security) authenticateToken(r *http.Request) (*http.Request, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !S.Enabled() {
+		return r, nil
+	}
+
+	var t ApiToken
+	if err := S.db.Where("hash = ?", hashApiToken(strings.TrimSpace(token))).Take(&t).Error; err != nil {
+		return r, errors.New("invalid token")
+	}
+	if t.Expired(time.Now()) {
+		return r, errors.New("token expired")
+	}
+	var u BaseUser
+	if err := S.db.Preload("Roles").First(&u, t.UserId).Error; err != nil || !u.Active {
+		return r, errors.New("invalid token")
+	}
+	S.db.Model(&t).Update("last_used_at", time.Now())
+
+	ctx := context.WithValue(r.Context(), userKey{}, &u)
+	ctx = context.WithValue(ctx, tokenKey{}, &t)
+	// no cookie from scripts, nothing to forge
+	return csrf.UnsafeSkipCheck(r.WithContext(ctx)), nil
+}
+
+// Paths of rest api of model views, the only ones accepting bearer token
+func (A *Admin) isTokenPath(path string) bool {
+	for _, view := range A.views {
+		V, ok := view.(*ModelView)
+		if !ok || !V.can_api {
+			continue
+		}
+		base := must(V.Blueprint.GetUrl(".api"))
+		if id, ok := strings.CutPrefix(path, base+"/"); path == base || ok && id != "" && !strings.Contains(id, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Tokens of current user, create with name, scopes and days to expire
+func (S *Security) apiTokensHandler(w http.ResponseWriter, r *http.Request) {
+	u := S.CurrentUser(r)
+	if u == nil {
+		http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+		return
+	}
+
+	var token string
+	var err error
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		scopes := []Permission{}
+		for _, s := range r.PostForm["scopes"] {
+			scopes = append(scopes, Permission(s))
+		}
+		days := cast.ToInt(r.PostFormValue("expires"))
+		name := emptyOr(strings.TrimSpace(r.PostFormValue("name")), gettext("API token"))
+		token, _, err = S.CreateApiToken(u, name, scopes, time.Duration(days)*24*time.Hour)
+		if err == nil {
+			S.AddFlash(r, FlashSuccess(gettext("API token was created. Copy it now, it will not be shown again.")))
+		}
+	}
+
+	var tokens []ApiToken
+	S.db.Where("user_id = ?", u.Id).Order("id").Find(&tokens)
+	S.Render(w, r, "templates/api_tokens.gotmpl", nil, map[string]any{
+		"name":       gettext("API tokens"),
+		"tokens":     tokens,
+		"token":      token,
+		"error":      err,
+		"scopes":     apiScopes,
+		"now":        time.Now(),
+		"delete_url": must(S.Blueprint.GetUrl("security.api_token_delete")),
+		"csrf_field": csrf.TemplateField(r),
+	})
+}
+
+// POST id, revoke a token of current user
+func (S *Security) apiTokenDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	u := S.CurrentUser(r)
+	if u != nil && r.Method == http.MethodPost {
+		S.db.Where("user_id = ? AND id = ?", u.Id, r.PostFormValue("id")).
+			Delete(&ApiToken{})
+	}
+	http.Redirect(w, r, must(S.Blueprint.GetUrl("security.api_tokens")), http.StatusFound)
+}
@@ -0,0 +1,96 @@
+package gadm
+
+import (
+	"html"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Request without cookie and csrf token
+func bearer(h *Admin, method, path, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+var apiTokenPattern = regexp.MustCompile(`id="api-token" value="([^"]+)"`)
+
+func TestApiToken(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	admin.AddView(NewModelView(Gadget{}, db).SetApi(true))
+	admin.freeze()
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&Gadget{Name: "gear"})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	// created on the page, shown once
+	w := c.post("/admin/api_tokens", "/admin/api_tokens", url.Values{"name": {"ci"}, "scopes": {"list", "create"}, "expires": {"7"}})
+	is.Equal(200, w.Code)
+	m := apiTokenPattern.FindStringSubmatch(w.Body.String())
+	is.NotNil(m)
+	token := html.UnescapeString(m[1])
+	is.True(strings.HasPrefix(token, "gadm_"))
+
+	var saved ApiToken
+	db.First(&saved)
+	is.Equal("ci", saved.Name)
+	is.Equal("list,create", saved.Scopes)
+	is.NotEqual(token, saved.Hash)
+	is.True(saved.ExpiresAt.Valid)
+
+	body := c.do("GET", "/admin/api_tokens", nil).Body.String()
+	is.Contains(body, saved.Prefix)
+	is.NotContains(body, token)
+	is.Contains(c.post("/admin/api_tokens", "/admin/api_tokens", url.Values{"scopes": {"admin"}}).Body.String(), "Select at least one scope.")
+
+	// bearer, without session and csrf
+	w = bearer(admin, "GET", "/admin/gadget/api", token, "")
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), `"gear"`)
+	is.Equal(201, bearer(admin, "POST", "/admin/gadget/api", token, `{"name": "cog"}`).Code)
+	db.First(&saved)
+	is.True(saved.LastUsedAt.Valid)
+
+	// out of scopes
+	is.Equal(403, bearer(admin, "DELETE", "/admin/gadget/api/1", token, "").Code)
+
+	// only the rest api accepts token
+	listed, _, err := admin.Security().CreateApiToken(alice, "ro", []Permission{PermList}, 0)
+	is.Nil(err)
+	is.Equal(200, bearer(admin, "GET", "/admin/gadget/api/1", listed, "").Code)
+	is.Equal(403, bearer(admin, "POST", "/admin/api_tokens", listed, "name=all&scopes=delete").Code)
+	is.Equal(403, bearer(admin, "POST", "/admin/console", listed, "sql=DELETE FROM gadget").Code)
+	is.Equal(403, bearer(admin, "GET", "/admin/gadget/", listed, "").Code)
+	is.Equal(403, bearer(admin, "GET", "/admin/gadget/api/1/x", listed, "").Code)
+	var n int64
+	db.Model(&ApiToken{}).Count(&n)
+	is.Equal(int64(2), n)
+
+	w = bearer(admin, "GET", "/admin/gadget/api", "gadm_wrong", "")
+	is.Equal(401, w.Code)
+	is.Contains(w.Header().Get("WWW-Authenticate"), "Bearer")
+
+	// expired
+	expired, _, err := admin.Security().CreateApiToken(alice, "old", []Permission{PermList}, time.Hour)
+	is.Nil(err)
+	db.Model(&ApiToken{}).Where("name = ?", "old").Update("expires_at", time.Now().Add(-time.Minute))
+	is.Equal(401, bearer(admin, "GET", "/admin/gadget/api", expired, "").Code)
+
+	// revoked
+	is.Equal(302, c.post("/admin/api_tokens", "/admin/api_token_delete", url.Values{"id": {"1"}}).Code)
+	is.Equal(401, bearer(admin, "GET", "/admin/gadget/api", token, "").Code)
+}
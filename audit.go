@@ -0,0 +1,199 @@
+package gadm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditLog.Action
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// One change made through ModelView
+type AuditLog struct {
+	Id        int       `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	UserId    null.Int  `gorm:"index"`
+	// BaseUser.String() at the time
+	User string `gorm:"size:255"`
+	// endpoint of ModelView, like "company"
+	Model  string `gorm:"index:idx_audit_log_record;not null;size:64"`
+	Pk     string `gorm:"index:idx_audit_log_record;not null;size:255"`
+	Action string `gorm:"not null;size:16"`
+	// json of changed columns, whole row for create and delete
+	Before string `gorm:"type:text"`
+	After  string `gorm:"type:text"`
+}
+
+// Record changes of all ModelView
+type Audit struct {
+	admin *Admin
+	db    *gorm.DB
+	view  *ModelView
+}
+
+func (A *Admin) Audit() *Audit { return A.audit }
+
+// Keep the log in db, and add a read-only view to browse it.
+// The view requires role admin, change with View().SetAccessRoles.
+func (Au *Audit) SetDB(db *gorm.DB) *Audit {
+	Au.db = db
+	Au.view = NewModelView(AuditLog{}, db, "Security").
+		SetCanCreate(false).
+		SetCanEdit(false).
+		SetColumnFilters("user", "model", "pk", "action", "created_at").
+		SetColumnSearchableList("model", "pk", "user").
+		SetCanDelete(false)
+	Au.view.SetAccessRoles("admin")
+	Au.view.row_scope = Au.visibleModels
+	Au.admin.AddView(Au.view)
+	return Au
+}
+
+// Entries of the models the user can list
+func (Au *Audit) visibleModels(r *http.Request) clause.Expression {
+	models := []any{}
+	for _, view := range Au.admin.views {
+		if V, ok := view.(*ModelView); ok && V.can(r, PermList) {
+			models = append(models, V.Blueprint.Endpoint)
+		}
+	}
+	if len(models) == 0 {
+		return clause.Expr{SQL: "1 = 0"}
+	}
+	return clause.IN{Column: clause.Column{Name: "model"}, Values: models}
+}
+
+func (Au *Audit) Enabled() bool { return Au != nil && Au.db != nil }
+
+// Built-in view of audit log
+func (Au *Audit) View() *ModelView { return Au.view }
+
+// History of one record, oldest first
+func (Au *Audit) History(model, pk string) ([]AuditLog, error) {
+	var ls []AuditLog
+	err := Au.db.Where("model = ? AND pk = ?", model, pk).Order("id").Find(&ls).Error
+	return ls, err
+}
+
+// Column values of record in ptr, by db name
+type snapshot map[string]any
+
+func (V *ModelView) snapshotOf(ptr any) snapshot {
+	rv := reflect.ValueOf(ptr)
+	s := snapshot{}
+	for _, f := range V.schema.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		v, _ := f.ValueOf(context.Background(), rv)
+		s[f.DBName] = v
+	}
+	return s
+}
+
+// Primary key in url form: pk1,pk2
+func (V *ModelView) pkOf(s snapshot) string {
+	vs := []string{}
+	for _, f := range V.schema.PrimaryFields {
+		vs = append(vs, cast.ToString(s[f.DBName]))
+	}
+	return strings.Join(vs, ",")
+}
+
+// Load records in snapshot, inside tx
+func (V *ModelView) snapshots(tx *gorm.DB, rowids ...string) ([]snapshot, error) {
+	res := []snapshot{}
+	for _, rowid := range rowids {
+		ptr := V.Model.new()
+		if err := V.take(tx, rowid, ptr); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, V.snapshotOf(ptr))
+	}
+	return res, nil
+}
+
+// Snapshots of records when audit is enabled, otherwise nil
+func (V *ModelView) audited(tx *gorm.DB, rowids ...string) ([]snapshot, error) {
+	if V.admin == nil || !V.admin.Audit().Enabled() {
+		return nil, nil
+	}
+	return V.snapshots(tx, rowids...)
+}
+
+// Changed columns only, compare in json
+func diff(before, after snapshot) (snapshot, snapshot) {
+	b, a := snapshot{}, snapshot{}
+	for k, v := range after {
+		bs1, _ := json.Marshal(before[k])
+		bs2, _ := json.Marshal(v)
+		if string(bs1) != string(bs2) {
+			b[k], a[k] = before[k], v
+		}
+	}
+	return b, a
+}
+
+func toJson(s snapshot) string {
+	if s == nil {
+		return ""
+	}
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return err.Error()
+	}
+	return string(bs)
+}
+
+// Write one entry of audit log, in tx when the log is in the same db
+func (V *ModelView) audit(ctx context.Context, tx *gorm.DB, action, pk string, before, after snapshot) error {
+	if V.admin == nil || !V.admin.Audit().Enabled() {
+		return nil
+	}
+	Au := V.admin.Audit()
+	if action == AuditUpdate {
+		if before, after = diff(before, after); len(after) == 0 {
+			return nil
+		}
+	}
+
+	l := AuditLog{
+		Model:  V.Blueprint.Endpoint,
+		Pk:     pk,
+		Action: action,
+		Before: toJson(before),
+		After:  toJson(after),
+	}
+	if u, ok := ctx.Value(userKey{}).(*BaseUser); ok {
+		l.UserId = null.IntFrom(int64(u.Id))
+		l.User = u.String()
+	}
+
+	db := Au.db
+	if db == V.db {
+		db = tx
+	}
+	if err := db.Create(&l).Error; err != nil {
+		log.Printf("audit %s %s failed: %s", l.Model, l.Pk, err)
+		return err
+	}
+	return nil
+}
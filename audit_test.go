@@ -0,0 +1,111 @@
+package gadm
+
+import (
+	"gadm/examples/sqla"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Audit().SetDB(db)
+	admin.AddView(NewModelView(sqla.Company{}, db).SetColumnEditableList("name"))
+	admin.AddView(NewModelView(Gadget{}, db).SetAccessRoles("hr").SetColumnFilters("stock"))
+	admin.freeze()
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	admin.Security().AddRoles(alice, "admin")
+	admin.Security().CreateUser("bob@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	logs := func() []AuditLog {
+		var ls []AuditLog
+		db.Order("id").Find(&ls)
+		return ls
+	}
+
+	is.Equal(302, c.post("/admin/company/new", "/admin/company/new", url.Values{"name": {"Acme"}}).Code)
+	is.Equal(302, c.post("/admin/company/new", "/admin/company/new", url.Values{"name": {"Globex"}}).Code)
+	ls := logs()
+	is.Len(ls, 2)
+	is.Equal(AuditCreate, ls[0].Action)
+	is.Equal("company", ls[0].Model)
+	is.Equal("1", ls[0].Pk)
+	is.Equal("alice@example.com", ls[0].User)
+	is.True(ls[0].UserId.Valid)
+	is.Equal("", ls[0].Before)
+	is.JSONEq(`{"id":1,"name":"Acme"}`, ls[0].After)
+
+	// edit, only changed columns
+	is.Equal(302, c.post("/admin/company/edit?id=1", "/admin/company/edit?id=1", url.Values{"name": {"Acme Inc"}}).Code)
+	// not changed, no log
+	is.Equal(302, c.post("/admin/company/edit?id=1", "/admin/company/edit?id=1", url.Values{"name": {"Acme Inc"}}).Code)
+	ls = logs()
+	is.Len(ls, 3)
+	is.Equal(AuditUpdate, ls[2].Action)
+	is.JSONEq(`{"name":"Acme"}`, ls[2].Before)
+	is.JSONEq(`{"name":"Acme Inc"}`, ls[2].After)
+
+	// x-editable, logged by canonical primary key
+	w := c.post("/admin/company/", "/admin/company/ajax/update", url.Values{"list_form_pk": {"02"}, "name": {"Globex Corp"}})
+	is.Equal(200, w.Code)
+	ls = logs()
+	is.Len(ls, 4)
+	is.Equal("2", ls[3].Pk)
+	is.JSONEq(`{"name":"Globex Corp"}`, ls[3].After)
+
+	// delete one and batch
+	is.Equal(302, c.post("/admin/company/new", "/admin/company/new", url.Values{"name": {"Initech"}}).Code)
+	is.Equal(302, c.post("/admin/company/", "/admin/company/delete", url.Values{"id": {"1"}}).Code)
+	is.Equal(302, c.post("/admin/company/", "/admin/company/action",
+		url.Values{"action": {"delete"}, "rowid": {"2", "3"}}).Code)
+	ls = logs()
+	is.Len(ls, 8)
+	// malformed id deletes nothing and is not logged
+	db.Create(&sqla.Company{Name: "Hooli"})
+	is.Equal(302, c.post("/admin/company/", "/admin/company/action",
+		url.Values{"action": {"delete"}, "rowid": {"7,7"}}).Code)
+	is.Len(logs(), 8)
+	var n int64
+	db.Model(&sqla.Company{}).Count(&n)
+	is.Equal(int64(1), n)
+	is.Equal(AuditDelete, ls[5].Action)
+	is.JSONEq(`{"id":1,"name":"Acme Inc"}`, ls[5].Before)
+	is.Equal("", ls[5].After)
+	is.ElementsMatch([]string{"2", "3"}, []string{ls[6].Pk, ls[7].Pk})
+
+	hs, err := admin.Audit().History("company", "1")
+	is.Nil(err)
+	is.Len(hs, 3)
+
+	// read-only view
+	w = c.do("GET", "/admin/auditlog/?search=company", nil)
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "Globex Corp")
+	is.Contains(w.Body.String(), "alice@example.com")
+	is.Equal(302, c.do("GET", "/admin/auditlog/new", nil).Code)
+	is.Equal(302, c.post("/admin/company/", "/admin/auditlog/delete", url.Values{"id": {"1"}}).Code)
+	is.Len(logs(), 8)
+
+	// only entries of models the user can list
+	db.Create(&AuditLog{Model: "gadget", Pk: "1", Action: AuditCreate, After: `{"name":"secret gadget"}`})
+	body := c.do("GET", "/admin/auditlog/", nil).Body.String()
+	is.Contains(body, "Globex Corp")
+	is.NotContains(body, "secret gadget")
+	is.NotContains(c.do("GET", "/admin/auditlog/?search=gadget", nil).Body.String(), "secret gadget")
+	is.NotContains(c.do("GET", "/admin/auditlog/details?id=9", nil).Body.String(), "secret gadget")
+	is.Contains(c.do("GET", "/admin/auditlog/details?id=8", nil).Body.String(), "alice@example.com")
+
+	// admin role required
+	bob := newTestClient(admin)
+	bob.post("/admin/login", "/admin/login", url.Values{"email": {"bob@example.com"}, "password": {"secret"}})
+	is.Equal(200, bob.do("GET", "/admin/company/", nil).Code)
+	w = bob.do("GET", "/admin/auditlog/", nil)
+	is.NotEqual(200, w.Code)
+	is.NotContains(w.Body.String(), "Globex Corp")
+}
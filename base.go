@@ -16,6 +16,7 @@ import (
 	"slices"
 	"sync"
 
+	"github.com/gorilla/sessions"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 )
@@ -144,6 +145,8 @@ type cachedWriter struct {
 	cache      bytes.Buffer
 	header     http.Header
 	statusCode int
+	// headers sent, write through
+	flushed bool
 }
 
 // Some go template actions might change headers(Cookie)
@@ -156,9 +159,15 @@ func NewCachedWriter(w http.ResponseWriter) *cachedWriter {
 	}
 }
 
-func (cw *cachedWriter) Header() http.Header         { return cw.header }
-func (cw *cachedWriter) Write(b []byte) (int, error) { return cw.cache.Write(b) }
-func (cw *cachedWriter) WriteHeader(statusCode int)  { cw.statusCode = statusCode }
+func (cw *cachedWriter) Header() http.Header        { return cw.header }
+func (cw *cachedWriter) WriteHeader(statusCode int) { cw.statusCode = statusCode }
+
+func (cw *cachedWriter) Write(b []byte) (int, error) {
+	if cw.flushed {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.cache.Write(b)
+}
 
 // Hijack implements the http.Hijacker interface by attempting to unwrap the writer.
 func (cw *cachedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
@@ -183,14 +192,30 @@ func (cw *cachedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return nil, nil, http.ErrNotSupported
 }
 
+// Output headers and cached body, then write through for streaming.
+// Later flush sends the written body to client.
 func (cw *cachedWriter) Flush() {
-	for k, vs := range cw.header {
-		for _, v := range vs {
-			cw.ResponseWriter.Header().Add(k, v)
+	if !cw.flushed {
+		for k, vs := range cw.header {
+			for _, v := range vs {
+				cw.ResponseWriter.Header().Add(k, v)
+			}
 		}
+		cw.ResponseWriter.WriteHeader(cw.statusCode)
+		cw.ResponseWriter.Write(cw.cache.Bytes())
+		cw.cache.Reset()
+		cw.flushed = true
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Send headers of response, the body is not cached after.
+// Session is saved before, it can not change later.
+func startStream(w http.ResponseWriter, r *http.Request) error {
+	if err := sessions.Save(r, w); err != nil {
+		return err
 	}
-	cw.ResponseWriter.WriteHeader(cw.statusCode)
-	cw.ResponseWriter.Write(cw.cache.Bytes())
+	return http.NewResponseController(w).Flush()
 }
 
 type groupTempl struct {
@@ -230,7 +255,8 @@ func (gt *groupTempl) getOrParse(fns []string, funcs template.FuncMap) *template
 }
 
 func (gt *groupTempl) Render(w http.ResponseWriter, fn string, funcs template.FuncMap, data map[string]any) error {
-	tpl := gt.getOrParse([]string{fn}, funcs)
+	// funcs are bound to the request, never execute the cached one
+	tpl := must(gt.getOrParse([]string{fn}, funcs).Clone()).Funcs(funcs)
 	w.Header().Add("content-type", ContentTypeUtf8Html)
 	bn := path.Base(fn)
 	return tpl.ExecuteTemplate(w, bn, data)
@@ -33,7 +33,8 @@ func main() {
 	ve := gadm.NewModelView(sqla.Employee{}, db, "BelongsTo").
 		Joins("Company").
 		AddLookupRefer(sqla.Company{}, "name").
-		SetColumnFilters("name")
+		SetColumnFilters("name").
+		SetApi(true)
 	a.AddView(ve)
 
 	a.AddView(gadm.NewModelView(sqla.CreditCard{}, db, "HasOne"))
@@ -43,9 +44,13 @@ func main() {
 
 	a.AddView(gadm.NewModelView(sqla.Address{}, db, "HasMany"))
 	va := gadm.NewModelView(sqla.Account{}, db, "HasMany").
-		Preloads("Addresses")
+		Preloads("Addresses").
+		SetInlineModels(sqla.Address{})
 	a.AddView(va)
 
+	a.AddView(gadm.NewModelView(sqla.Language{}, db, "ManyToMany"))
+	a.AddView(gadm.NewModelView(sqla.Student{}, db, "ManyToMany"))
+
 	a.AddView(gadm.NewModelView(sqla.Toy{}, db, "Polymorphism"))
 	vt := gadm.NewModelView(sqla.Dog{}, db, "Polymorphism").
 		Preloads("Toys")
@@ -0,0 +1,473 @@
+package gadm
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Formats of export, in order of the export menu
+var exportTypes = []string{"csv", "xlsx", "json", "ndjson"}
+
+// Formats in the export menu, of csv, xlsx, json and ndjson
+func (V *ModelView) SetExportTypes(types ...string) *ModelView {
+	V.export_types = lo.Filter(types, func(t string, _ int) bool {
+		return slices.Contains(exportTypes, t)
+	})
+	return V
+}
+
+// Columns of export, default the columns of list view
+func (V *ModelView) SetColumnExportList(columns ...string) *ModelView {
+	V.column_export_list = columns
+	return V
+}
+
+// Fields of export, in order of column_export_list
+func (V *ModelView) exportFields(fs []*Field) []*Field {
+	if len(V.column_export_list) == 0 {
+		return lo.Filter(V.fsList, func(f *Field, _ int) bool { return f.DBName != "" })
+	}
+	res := []*Field{}
+	for _, c := range V.column_export_list {
+		if f, ok := lo.Find(fs, func(f *Field) bool { return f.DBName == c }); ok {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// Write rows in one of exportTypes, Flush after each batch and Close after the last row
+type rowWriter interface {
+	Write(row *Row) error
+	Flush() error
+	Close() error
+}
+
+func newRowWriter(format string, w io.Writer, fields []*Field) (rowWriter, error) {
+	switch format {
+	case "csv":
+		return newCsvWriter(w, fields)
+	case "xlsx":
+		return newXlsxWriter(w, fields)
+	case "json":
+		return newJsonWriter(w, fields, false)
+	case "ndjson":
+		return newJsonWriter(w, fields, true)
+	}
+	return nil, fmt.Errorf("unknown export type %q", format)
+}
+
+func exportContentType(format string) string {
+	return map[string]string{
+		"csv":    "text/csv",
+		"xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"json":   "application/json",
+		"ndjson": "application/x-ndjson",
+	}[format]
+}
+
+// Value of cell: nil, bool, int64, uint64, float64, string or time.Time
+func cellValue(f *Field) any {
+	v := f.Value
+	if vr, ok := v.(driver.Valuer); ok && !isNil(v) {
+		v, _ = vr.Value()
+	}
+	if isNil(v) {
+		return nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	}
+	switch v := rv.Interface().(type) {
+	case time.Time:
+		return v
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(rv.Interface())
+}
+
+type csvWriter struct {
+	cw     *csv.Writer
+	fields []*Field
+}
+
+func newCsvWriter(w io.Writer, fields []*Field) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	err := cw.Write(lo.Map(fields, func(f *Field, _ int) string { return f.DBName }))
+	return &csvWriter{cw: cw, fields: fields}, err
+}
+
+func (c *csvWriter) Write(row *Row) error {
+	return c.cw.Write(lo.Map(c.fields, func(f *Field, _ int) string {
+		if f := row.FieldOf(f); f != nil {
+			return f.Display()
+		}
+		return ""
+	}))
+}
+
+func (c *csvWriter) Flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func (c *csvWriter) Close() error { return c.Flush() }
+
+// Array of objects, or one object per line
+type jsonWriter struct {
+	w      io.Writer
+	fields []*Field
+	lines  bool
+	n      int
+}
+
+func newJsonWriter(w io.Writer, fields []*Field, lines bool) (*jsonWriter, error) {
+	return &jsonWriter{w: w, fields: fields, lines: lines}, nil
+}
+
+// Object in the order of fields
+func (j *jsonWriter) Write(row *Row) error {
+	var b bytes.Buffer
+	switch {
+	case j.lines:
+	case j.n == 0:
+		b.WriteString("[\n")
+	default:
+		b.WriteString(",\n")
+	}
+	b.WriteByte('{')
+	for i, f := range j.fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		var v any
+		if rf := row.FieldOf(f); rf != nil {
+			v = cellValue(rf)
+		}
+		k, _ := json.Marshal(f.DBName)
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(bs)
+	}
+	b.WriteByte('}')
+	if j.lines {
+		b.WriteByte('\n')
+	}
+	j.n++
+	_, err := j.w.Write(b.Bytes())
+	return err
+}
+
+func (j *jsonWriter) Flush() error { return nil }
+
+func (j *jsonWriter) Close() error {
+	if j.lines {
+		return nil
+	}
+	end := "\n]\n"
+	if j.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// Workbook of one sheet, cells of inline strings, numbers, booleans and dates
+type xlsxWriter struct {
+	zw     *zip.Writer
+	sheet  io.Writer
+	fields []*Field
+	n      int
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+	// style 1 for date time cells
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`</styleSheet>`
+)
+
+func newXlsxWriter(w io.Writer, fields []*Field) (*xlsxWriter, error) {
+	x := &xlsxWriter{zw: zip.NewWriter(w), fields: fields}
+	for _, part := range [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		fw, err := x.zw.Create(part[0])
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, part[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	// rows of sheet are streamed, the last part of zip
+	sheet, err := x.zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x.sheet = sheet
+	if _, err := io.WriteString(sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+	return x, x.writeCells(lo.Map(fields, func(f *Field, _ int) any { return f.DBName }))
+}
+
+func (x *xlsxWriter) Write(row *Row) error {
+	return x.writeCells(lo.Map(x.fields, func(f *Field, _ int) any {
+		if rf := row.FieldOf(f); rf != nil {
+			return cellValue(rf)
+		}
+		return nil
+	}))
+}
+
+func (x *xlsxWriter) writeCells(values []any) error {
+	x.n++
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<row r="%d">`, x.n)
+	for i, v := range values {
+		ref := xlsxColumn(i) + strconv.Itoa(x.n)
+		switch v := v.(type) {
+		case nil:
+			// null is empty
+		case bool:
+			fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, lo.Ternary(v, 1, 0))
+		case int64, uint64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case float64:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'g', -1, 64))
+		case time.Time:
+			fmt.Fprintf(&b, `<c r="%s" s="1"><v>%s</v></c>`, ref, strconv.FormatFloat(excelTime(v), 'f', -1, 64))
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(&b, []byte(fmt.Sprint(v)))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+	_, err := x.sheet.Write(b.Bytes())
+	return err
+}
+
+func (x *xlsxWriter) Flush() error { return x.zw.Flush() }
+
+func (x *xlsxWriter) Close() error {
+	if _, err := io.WriteString(x.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+// A, B, ... Z, AA, AB, ...
+func xlsxColumn(i int) string {
+	s := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		s = string(rune('A'+(i-1)%26)) + s
+	}
+	return s
+}
+
+// Days since 1899-12-30 of the wall clock
+func excelTime(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Seconds() / 86400
+}
+
+// Rows of export are read in batches of primary key, default 1000
+func (V *ModelView) SetExportBatchSize(n int) *ModelView {
+	V.export_batch_size = n
+	return V
+}
+
+// Walk all rows of query in the order of the list, size rows each batch.
+// Unsorted rows are walked by primary key, sorted rows and composite primary key
+// by offset with primary key as tiebreaker.
+func (V *ModelView) exportBatches(ctx context.Context, q *Query, fields []*Field, size int, fn func(rows []*Row) error) error {
+	// conditions of filters and search, grouped
+	nq := *q
+	nq.Sort = ""
+	filtered := V.applyQuery(V.db.Session(&gorm.Session{NewDB: true}), &nq, true)
+
+	var sort *clause.OrderByColumn
+	if name := V.column_name(cast.ToInt(q.Sort)); q.Sort != "" && name != "" {
+		sort = &clause.OrderByColumn{Column: clause.Column{Name: name}, Desc: q.Desc}
+	}
+
+	pk := V.schema.PrioritizedPrimaryField
+	keyset := pk != nil && sort == nil
+	var last any
+	for page := 0; ; page++ {
+		db := V.db.WithContext(ctx).Where(filtered).Limit(size)
+		if keyset {
+			col := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+			if last != nil {
+				db = db.Where(clause.Gt{Column: col, Value: last})
+			}
+			db = db.Order(clause.OrderByColumn{Column: col})
+		} else {
+			if sort != nil {
+				db = db.Order(*sort)
+			}
+			for _, f := range V.schema.PrimaryFields {
+				db = db.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}})
+			}
+			db = db.Offset(page * size)
+		}
+
+		ptr := V.newSlice()
+		db = V.preloadTags(db, fields)
+		if err := V.applyJoins(db).Find(ptr.Interface()).Error; err != nil {
+			return err
+		}
+		n := ptr.Elem().Len()
+		rows := make([]*Row, n)
+		for i := range n {
+			rows[i] = NewRow(fields, ptr.Elem().Index(i).Interface())
+		}
+		if n > 0 && keyset {
+			last, _ = pk.ValueOf(ctx, ptr.Elem().Index(n-1))
+		}
+		if err := fn(rows); err != nil {
+			return err
+		}
+		if n < size {
+			return nil
+		}
+	}
+}
+
+// Stream all rows of query in the format of export_type, by batches in the order of the list.
+// Gzip when accepted by client.
+func (V *ModelView) exportHandler(w http.ResponseWriter, r *http.Request) {
+	if !V.can(r, PermExport) {
+		V.redirect(w, r)
+		return
+	}
+	format := emptyOr(r.URL.Query().Get("export_type"), "csv")
+	if !slices.Contains(V.export_types, format) {
+		http.Error(w, fmt.Sprintf("unknown export type %q", format), http.StatusBadRequest)
+		return
+	}
+
+	fn := fmt.Sprintf("attachment;filename=%s-%s.%s", V.name(),
+		time.Now().Format(time.DateOnly), format)
+	w.Header().Add("content-disposition", fn)
+	w.Header().Add("content-type", exportContentType(format))
+	w.Header().Add("vary", "Accept-Encoding")
+
+	var out io.Writer = w
+	var gz *gzip.Writer
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.Header().Set("content-encoding", "gzip")
+		gz = gzip.NewWriter(w)
+		out = gz
+	}
+
+	rw, err := newRowWriter(format, out, V.fsExport)
+	if err == nil {
+		err = startStream(w, r)
+	}
+	if err != nil {
+		w.Header().Del("content-encoding")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	err = V.exportBatches(r.Context(), V.queryFrom(r), V.fsExport, V.export_batch_size, func(rows []*Row) error {
+		for _, row := range rows {
+			if err := rw.Write(row); err != nil {
+				return err
+			}
+		}
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+		}
+		return rc.Flush()
+	})
+	if err == nil {
+		err = rw.Close()
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	// status is sent, the file is cut
+	if err != nil {
+		log.Printf("export %s: %v", V.name(), err)
+	}
+}
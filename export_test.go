@@ -0,0 +1,172 @@
+package gadm
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v4"
+)
+
+type Shipment struct {
+	Id        uint
+	Name      string
+	Weight    float64
+	Count     int
+	ShippedAt time.Time
+	Note      null.String
+}
+
+func TestExport(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Shipment{}, db))
+	admin.AddView(NewModelView(Gadget{}, db).SetColumnExportList("name", "price", "id").SetExportTypes("csv", "json"))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	shipped := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 25 {
+		db.Create(&Shipment{Name: "box", Weight: 1.5, Count: i, ShippedAt: shipped})
+	}
+	db.Create(&Shipment{Name: `a "b" <c>`, Note: null.StringFrom("fragile"), ShippedAt: shipped})
+	db.Create(&Gadget{Name: "gear", Price: 9.5})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	body := c.do("GET", "/admin/shipment/", nil).Body.String()
+	is.Contains(body, "export_type=xlsx")
+	is.Contains(body, "export_type=ndjson")
+
+	// all pages
+	w := c.do("GET", "/admin/shipment/export?export_type=csv", nil)
+	is.Equal("text/csv", w.Header().Get("content-type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	is.Len(lines, 27)
+	is.Equal("id,name,weight,count,shipped_at,note", lines[0])
+
+	w = c.do("GET", "/admin/shipment/export?export_type=json", nil)
+	is.Contains(w.Header().Get("content-disposition"), ".json")
+	var objs []map[string]any
+	is.Nil(json.Unmarshal(w.Body.Bytes(), &objs))
+	is.Len(objs, 26)
+	is.Equal(1.5, objs[0]["weight"])
+	is.Equal(float64(0), objs[0]["count"])
+	is.Equal("2024-03-01T12:00:00Z", objs[0]["shipped_at"])
+	is.Nil(objs[0]["note"])
+	is.Equal("fragile", objs[25]["note"])
+	is.True(strings.HasPrefix(w.Body.String(), `[`+"\n"+`{"id":1,"name":"box",`))
+
+	w = c.do("GET", "/admin/shipment/export?export_type=ndjson&search=&flt0_0=", nil)
+	is.Equal("application/x-ndjson", w.Header().Get("content-type"))
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	is.Len(lines, 26)
+	is.JSONEq(`{"id":26,"name":"a \"b\" <c>","weight":0,"count":0,"shipped_at":"2024-03-01T12:00:00Z","note":"fragile"}`, lines[25])
+
+	// native workbook
+	w = c.do("GET", "/admin/shipment/export?export_type=xlsx", nil)
+	is.Contains(w.Header().Get("content-type"), "spreadsheetml")
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	is.Nil(err)
+	names := []string{}
+	var sheet string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			bs, _ := io.ReadAll(rc)
+			sheet = string(bs)
+		}
+	}
+	is.Contains(names, "[Content_Types].xml")
+	is.Contains(names, "xl/workbook.xml")
+	is.Nil(xml.Unmarshal([]byte(sheet), new(struct{})))
+	is.Contains(sheet, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+	is.Contains(sheet, `<c r="C2"><v>1.5</v></c>`)
+	is.Contains(sheet, `<c r="E2" s="1"><v>45352.5</v></c>`)
+	is.Contains(sheet, `a &#34;b&#34; &lt;c&gt;`)
+	is.Contains(sheet, `<row r="27">`)
+	is.NotContains(sheet, `r="F2"`)
+
+	// export columns and types
+	w = c.do("GET", "/admin/gadget/export?export_type=csv", nil)
+	is.Equal("name,price,id\ngear,9.5,1\n", w.Body.String())
+	is.Equal(400, c.do("GET", "/admin/gadget/export?export_type=xlsx", nil).Code)
+	is.NotContains(c.do("GET", "/admin/gadget/", nil).Body.String(), "export_type=xlsx")
+}
+
+func TestExportStream(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	sv := NewModelView(Shipment{}, db).
+		SetColumnSearchableList("name", "note").
+		SetExportBatchSize(7)
+	admin.AddView(sv)
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	for i := range 30 {
+		db.Create(&Shipment{Name: fmt.Sprintf("box%02d", i), Count: i})
+	}
+	db.Model(&Shipment{}).Where("id IN ?", []int{3, 29}).Update("note", "fragile")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	// more than a page and a batch, sent while written
+	w := c.do("GET", "/admin/shipment/export?export_type=ndjson", nil)
+	is.True(w.Flushed)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	is.Len(lines, 30)
+	is.Contains(lines[29], `"id":30`)
+
+	// search of any column, within the batches
+	w = c.do("GET", "/admin/shipment/export?export_type=csv&search=fragile", nil)
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	is.Len(lines, 3)
+	is.True(strings.HasPrefix(lines[1], "3,box02,"))
+	is.True(strings.HasPrefix(lines[2], "29,box28,"))
+
+	// order of the list, primary key as tiebreaker
+	ids := func(query string) []string {
+		w := c.do("GET", "/admin/shipment/export?export_type=csv&"+query, nil)
+		var ids []string
+		for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n")[1:] {
+			ids = append(ids, strings.Split(line, ",")[0])
+		}
+		return ids
+	}
+	got := ids(fmt.Sprintf("sort=%d&desc=1", sv.get_column_index("count")))
+	is.Len(got, 30)
+	is.Equal([]string{"30", "29", "28"}, got[:3])
+	is.Equal("1", got[29])
+	got = ids(fmt.Sprintf("sort=%d&desc=1", sv.get_column_index("note")))
+	is.Len(got, 30)
+	is.Equal([]string{"3", "29", "1", "2", "4"}, got[:5])
+	is.Equal("30", got[29])
+
+	r := httptest.NewRequest("GET", "/admin/shipment/export?export_type=json", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, r)
+	is.Equal("gzip", w.Header().Get("content-encoding"))
+	zr, err := gzip.NewReader(w.Body)
+	is.Nil(err)
+	var objs []map[string]any
+	is.Nil(json.NewDecoder(zr).Decode(&objs))
+	is.Len(objs, 30)
+}
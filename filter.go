@@ -0,0 +1,210 @@
+package gadm
+
+import (
+	"strings"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Filter of list view, in query as flt<i>_<index>=value.
+// Filters of the same label are grouped in the Add Filter menu.
+type Filter interface {
+	Label() string
+	// like equal, in list, in last days
+	Operation() string
+	// [value, label] to choose from, nil for input
+	Options() [][]string
+	// select2-tags, datetimepicker, datetimerangepicker, or empty for input
+	WidgetType() string
+	// condition of the value
+	Apply(db *gorm.DB, value string) *gorm.DB
+}
+
+// Built-in filter on a column, also a column of joined table like `Company.name`
+type ColumnFilter struct {
+	label     string
+	column    string
+	operation string
+	options   [][]string
+	widget    string
+	dataType  schema.DataType
+}
+
+func (f *ColumnFilter) Label() string       { return f.label }
+func (f *ColumnFilter) Operation() string   { return f.operation }
+func (f *ColumnFilter) Options() [][]string { return f.options }
+func (f *ColumnFilter) WidgetType() string  { return f.widget }
+
+func (f *ColumnFilter) Apply(db *gorm.DB, q string) *gorm.DB {
+	switch f.operation {
+	case "empty":
+		if q == "1" {
+			db = db.Where(f.column + " IS NULL")
+		} else {
+			db = db.Where(f.column + " IS NOT NULL")
+		}
+	case "like":
+		db = db.Where(f.column+" LIKE ?", like(q))
+	case "not like":
+		db = db.Where(f.column+" NOT LIKE ?", like(q))
+	case "equal":
+		db = db.Where(f.column+" = ?", f.qvalue(q))
+	case "not equal":
+		db = db.Where(f.column+" <> ?", f.qvalue(q))
+	case "greater":
+		db = db.Where(f.column+" > ?", f.qvalue(q))
+	case "smaller":
+		db = db.Where(f.column+" < ?", f.qvalue(q))
+	case "in list":
+		db = db.Where(f.column+" IN ?", f.qlist(q))
+	case "not in list":
+		db = db.Where(f.column+" NOT IN ?", f.qlist(q))
+	case "between":
+		// 2025-11-19 00:00:00 to 2025-11-21 23:59:59
+		ts := f.qbetween(q)
+		db = db.Where(f.column+" BETWEEN ? AND ?", ts[0], ts[1])
+	case "not between":
+		ts := f.qbetween(q)
+		db = db.Where(f.column+" NOT BETWEEN ? AND ?", ts[0], ts[1])
+	}
+	return db
+}
+
+func (f *ColumnFilter) qbetween(q string) []string {
+	ts := strings.Split(q, " to ")
+	if len(ts) < 2 {
+		return []string{q, q}
+	}
+	return ts
+}
+
+// Value in type of column, decimal is compared as text to keep precision
+func (f *ColumnFilter) qvalue(q string) any {
+	switch f.dataType {
+	case schema.Bool:
+		return q == "1"
+	case schema.Int:
+		return cast.ToInt64(q)
+	case schema.Uint:
+		return cast.ToUint64(q)
+	case schema.Float:
+		return cast.ToFloat64(q)
+	case schema.Bytes:
+		return []byte(q)
+	}
+	return q
+}
+
+func (f *ColumnFilter) qlist(q string) any {
+	arr := strings.Split(q, ",")
+	switch f.dataType {
+	case schema.String:
+		return arr
+	case schema.Int, schema.Uint, schema.Float:
+		return lo.Map(arr, func(s string, _ int) any { return f.qvalue(s) })
+	}
+	return arr
+}
+
+var yesNo = [][]string{{"1", "Yes"}, {"0", "No"}}
+
+// Is the data type of a decimal column, like decimal(10,2) or numeric
+func isDecimal(dt schema.DataType) bool {
+	s := strings.ToLower(string(dt))
+	return strings.HasPrefix(s, "decimal") || strings.HasPrefix(s, "numeric")
+}
+
+// Built-in filters of column by data type, nil for unknown type
+func ColumnFilters(label, column string, dataType schema.DataType) []Filter {
+	of := func(operation string, options [][]string, widget string) Filter {
+		return &ColumnFilter{label: label, column: column, operation: operation,
+			options: options, widget: widget, dataType: dataType}
+	}
+	switch {
+	case dataType == schema.Bool:
+		return []Filter{
+			of("equal", yesNo, ""),
+			of("not equal", yesNo, ""),
+		}
+	case dataType == schema.Int, dataType == schema.Uint, dataType == schema.Float, isDecimal(dataType):
+		return []Filter{
+			of("equal", nil, ""),
+			of("not equal", nil, ""),
+			of("greater", nil, ""),
+			of("smaller", nil, ""),
+			of("empty", yesNo, ""),
+			of("in list", nil, "select2-tags"),
+			of("not in list", nil, "select2-tags"),
+		}
+	case dataType == schema.String:
+		return []Filter{
+			of("like", nil, ""),
+			of("not like", nil, ""),
+			of("equal", nil, ""),
+			of("not equal", nil, ""),
+			of("empty", yesNo, ""),
+			of("in list", nil, "select2-tags"),
+			of("not in list", nil, "select2-tags"),
+		}
+	case dataType == schema.Time:
+		return []Filter{
+			of("equal", nil, "datetimepicker"),
+			of("not equal", nil, "datetimepicker"),
+			of("greater", nil, "datetimepicker"),
+			of("smaller", nil, "datetimepicker"),
+			of("between", nil, "datetimerangepicker"),
+			of("not between", nil, "datetimerangepicker"),
+			of("empty", yesNo, ""),
+		}
+	case dataType == schema.Bytes:
+		return []Filter{
+			of("equal", nil, ""),
+			of("not equal", nil, ""),
+			of("empty", yesNo, ""),
+		}
+	}
+	return nil
+}
+
+// Filter of own label, options and condition, like "has orders" or "created in last days"
+type CustomFilter struct {
+	Name    string
+	Op      string
+	Choices [][]string
+	Widget  string
+	// condition of the value
+	Where func(db *gorm.DB, value string) *gorm.DB
+}
+
+func (f *CustomFilter) Label() string       { return f.Name }
+func (f *CustomFilter) Operation() string   { return f.Op }
+func (f *CustomFilter) Options() [][]string { return f.Choices }
+func (f *CustomFilter) WidgetType() string  { return f.Widget }
+
+func (f *CustomFilter) Apply(db *gorm.DB, value string) *gorm.DB {
+	return f.Where(db, value)
+}
+
+// Add filters after the ones of column_filters
+func (V *ModelView) AddFilters(fs ...Filter) *ModelView {
+	V.extra_filters = append(V.extra_filters, fs...)
+	return V
+}
+
+// Filters by label, in json read by filters.js
+func toGroup(fs []Filter) map[string][]map[string]any {
+	g := map[string][]map[string]any{}
+	for i, f := range fs {
+		g[f.Label()] = append(g[f.Label()], map[string]any{
+			"arg":       cast.ToString(i),
+			"index":     i,
+			"operation": f.Operation(),
+			"options":   f.Options(),
+			"type":      lo.Ternary[any](f.WidgetType() == "", nil, f.WidgetType()),
+		})
+	}
+	return g
+}
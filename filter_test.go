@@ -0,0 +1,123 @@
+package gadm
+
+import (
+	"encoding/json"
+	"html"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type Customer struct {
+	Id        uint
+	Name      string
+	Score     float64
+	Avatar    []byte
+	CreatedAt time.Time
+	Orders    []Order
+}
+
+type Order struct {
+	Id         uint
+	CustomerId uint
+	Customer   Customer
+	Amount     string `gorm:"type:decimal(10,2)"`
+}
+
+var filterGroupsPattern = regexp.MustCompile(`(?s)<div id="filter-groups-data" style="display:none;">(.*?)</div>`)
+
+func TestFilters(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Customer{}, db).
+		SetColumnFilters("id", "score", "avatar").
+		AddFilters(
+			&CustomFilter{Name: "Orders", Op: "has orders", Choices: yesNo,
+				Where: func(db *gorm.DB, v string) *gorm.DB {
+					exists := `EXISTS (SELECT 1 FROM "order" WHERE "order".customer_id = customer.id)`
+					if v == "1" {
+						return db.Where(exists)
+					}
+					return db.Where("NOT " + exists)
+				}},
+			&CustomFilter{Name: "Created", Op: "in last days",
+				Where: func(db *gorm.DB, v string) *gorm.DB {
+					return db.Where("created_at > ?", time.Now().AddDate(0, 0, -cast.ToInt(v)))
+				}},
+		))
+	admin.AddView(NewModelView(Order{}, db).
+		SetColumnFilters("amount").
+		Joins("Customer").
+		AddFilters(ColumnFilters("Customer", "Customer.name", schema.String)...))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	db.Create(&Customer{Name: "ann", Score: 4.5, Avatar: []byte("png"), Orders: []Order{{Amount: "10.50"}, {Amount: "99.99"}}})
+	db.Create(&Customer{Name: "bob", Score: 2, CreatedAt: time.Now().AddDate(0, 0, -30)})
+	db.Create(&Customer{Name: "cid", Score: 3, Orders: []Order{{Amount: "10.5"}}})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	names := func(path string) []string {
+		var res struct {
+			Data []map[string]any `json:"data"`
+		}
+		json.Unmarshal(c.do("GET", path, nil).Body.Bytes(), &res)
+		ns := []string{}
+		for _, d := range res.Data {
+			ns = append(ns, cast.ToString(d["name"]))
+		}
+		return ns
+	}
+
+	// uint, float, bytes, then custom, in json of filters.js
+	m := filterGroupsPattern.FindStringSubmatch(c.do("GET", "/admin/customer/", nil).Body.String())
+	is.NotNil(m)
+	var groups map[string][]map[string]any
+	is.Nil(json.Unmarshal([]byte(html.UnescapeString(m[1])), &groups))
+	is.Len(groups["Id"], 7)
+	is.Len(groups["Score"], 7)
+	is.Len(groups["Avatar"], 3)
+	is.Equal("select2-tags", groups["Id"][5]["type"])
+	is.Nil(groups["Id"][0]["type"])
+	is.Equal(float64(17), groups["Orders"][0]["index"])
+	is.Equal("17", groups["Orders"][0]["arg"])
+	is.Equal("has orders", groups["Orders"][0]["operation"])
+	is.Len(groups["Orders"][0]["options"], 2)
+	is.Equal("in last days", groups["Created"][0]["operation"])
+
+	is.Equal([]string{"ann"}, names("/admin/customer/list?flt0_0=1"))
+	is.Equal([]string{"bob", "cid"}, names("/admin/customer/list?flt0_2=1"))
+	is.Equal([]string{"ann", "cid"}, names("/admin/customer/list?flt0_9=2"))
+	is.Equal([]string{"ann"}, names("/admin/customer/list?flt0_14=png"))
+	is.Equal([]string{"bob", "cid"}, names("/admin/customer/list?flt0_16=1"))
+	is.Equal([]string{"ann", "cid"}, names("/admin/customer/list?flt0_17=1"))
+	is.Equal([]string{"bob"}, names("/admin/customer/list?flt0_17=0"))
+	is.Equal([]string{"ann", "cid"}, names("/admin/customer/list?flt0_18=7"))
+
+	// malformed or out of range index is ignored
+	all := []string{"ann", "bob", "cid"}
+	is.Equal(all, names("/admin/customer/list?flt0=1"))
+	is.Equal(all, names("/admin/customer/list?flt0_-1=1"))
+	is.Equal(all, names("/admin/customer/list?flt0_99=1"))
+	is.Equal(all, names("/admin/customer/list?flt0_1_2=1"))
+	is.Equal(200, c.do("GET", "/admin/customer/?flt0_-1=1", nil).Code)
+
+	// decimal and joined column
+	w := c.do("GET", "/admin/order/?flt0_2=50", nil)
+	is.Contains(w.Body.String(), "99.99")
+	is.NotContains(w.Body.String(), "10.5")
+	w = c.do("GET", "/admin/order/?flt0_7=ann", nil)
+	is.Contains(w.Body.String(), "99.99")
+	is.NotContains(w.Body.String(), ">10.5<")
+	var res struct{ Total int }
+	json.Unmarshal(c.do("GET", "/admin/order/list?flt0_9=cid", nil).Body.Bytes(), &res)
+	is.Equal(1, res.Total)
+}
@@ -78,6 +78,10 @@ type modelForm struct {
 	Fields    []*Field
 	Row       *Row
 	CSRFToken string
+	// by form name, after validate
+	Errors formErrors
+	// children of has many
+	Inlines []*inlineForm
 }
 
 func NewForm(fs []*Field, row *Row, csrfToken string) *modelForm {
@@ -16,9 +16,11 @@ require (
 	github.com/pedia/gadmin v0.0.0-20241029124951-214a8509e0d9
 	github.com/samber/lo v1.39.0
 	github.com/shopspring/decimal v1.2.0
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/spf13/cast v1.3.1
 	github.com/stretchr/testify v1.8.4
 	github.com/tdewolff/minify/v2 v2.24.4
+	golang.org/x/crypto v0.43.0
 	golang.org/x/net v0.46.0
 	gopkg.in/guregu/null.v4 v4.0.0
 	gopkg.in/leonelquinteros/gotext.v1 v1.3.1
@@ -54,7 +56,6 @@ require (
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	github.com/stoewer/go-strcase v1.3.0 // indirect
 	github.com/tdewolff/parse/v2 v2.8.4 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
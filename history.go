@@ -0,0 +1,190 @@
+package gadm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/gorilla/csrf"
+	"github.com/spf13/cast"
+)
+
+// Column values in json, by db name
+type recordState map[string]json.RawMessage
+
+func decodeState(s string) recordState {
+	st := recordState{}
+	if s != "" {
+		json.Unmarshal([]byte(s), &st)
+	}
+	return st
+}
+
+// One version of a record, after the change of AuditLog
+type recordVersion struct {
+	AuditLog
+	// 1 for the oldest
+	Number  int
+	Changes []columnChange
+	// nil when the record is deleted
+	state recordState
+	// revert to this version is possible
+	Revertable bool
+}
+
+type columnChange struct {
+	Column string
+	Before string
+	After  string
+}
+
+// json value for display, string without quotes
+func displayJson(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	if raw == nil || string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// Rebuild all versions from the current record backwards, oldest first
+func (V *ModelView) versions(ctx context.Context, rowid string) ([]*recordVersion, recordState, error) {
+	if V.admin == nil || !V.admin.Audit().Enabled() {
+		return nil, nil, errors.New("audit is disabled")
+	}
+
+	logs, err := V.admin.Audit().History(V.Blueprint.Endpoint, rowid)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current recordState
+	ss, err := V.snapshots(V.db.WithContext(ctx), rowid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ss) > 0 {
+		current = decodeState(toJson(ss[0]))
+	}
+
+	vs := make([]*recordVersion, len(logs))
+	st := current
+	for i := len(logs) - 1; i >= 0; i-- {
+		l := logs[i]
+		v := &recordVersion{AuditLog: l, Number: i + 1, state: st}
+
+		before, after := decodeState(l.Before), decodeState(l.After)
+		for _, col := range slices.Sorted(maps.Keys(overlay(before, after))) {
+			v.Changes = append(v.Changes, columnChange{col, displayJson(before[col]), displayJson(after[col])})
+		}
+		vs[i] = v
+
+		// state before the change
+		switch l.Action {
+		case AuditCreate:
+			st = nil
+		case AuditDelete:
+			st = before
+		default:
+			st = overlay(st, before)
+		}
+	}
+
+	for _, v := range vs {
+		v.Revertable = current != nil && v.state != nil &&
+			len(V.changedColumns(current, v.state)) > 0
+	}
+	return vs, current, nil
+}
+
+func overlay(a, b recordState) recordState {
+	c := maps.Clone(a)
+	if c == nil {
+		c = recordState{}
+	}
+	maps.Copy(c, b)
+	return c
+}
+
+// columns of target different from current, primary keys excluded
+func (V *ModelView) changedColumns(current, target recordState) []string {
+	cols := []string{}
+	for _, f := range V.schema.Fields {
+		if f.DBName == "" || f.PrimaryKey {
+			continue
+		}
+		if raw, ok := target[f.DBName]; ok && !bytes.Equal(raw, current[f.DBName]) {
+			cols = append(cols, f.DBName)
+		}
+	}
+	return cols
+}
+
+// Update the record to the version, through the normal update path
+func (V *ModelView) revert(ctx context.Context, rowid string, current, target recordState) error {
+	row := &Row{Map: map[string]any{}}
+	for _, col := range V.changedColumns(current, target) {
+		f := V.schema.LookUpField(col)
+		ptr := reflect.New(f.FieldType)
+		if err := json.Unmarshal(target[col], ptr.Interface()); err != nil {
+			return err
+		}
+		row.Map[col] = ptr.Elem().Interface()
+	}
+	if len(row.Map) == 0 {
+		return nil
+	}
+	return V.update(ctx, rowid, row)
+}
+
+// GET versions of one record, POST version=audit log id to revert
+func (V *ModelView) historyHandler(w http.ResponseWriter, r *http.Request) {
+	q := V.queryFrom(r)
+	rowid := q.Get("id")
+	if !V.can_view_details || rowid == "" {
+		V.redirect(w, r)
+		return
+	}
+
+	vs, current, err := V.versions(r.Context(), rowid)
+	if err != nil {
+		V.AddFlash(r, FlashError(err))
+		V.redirect(w, r)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !V.can(r, PermEdit) {
+			http.Error(w, gettext("You don't have the permission to access the requested resource."),
+				http.StatusForbidden)
+			return
+		}
+
+		id := cast.ToInt(r.PostFormValue("version"))
+		i := slices.IndexFunc(vs, func(v *recordVersion) bool { return v.Id == id })
+		if i == -1 || !vs[i].Revertable {
+			V.AddFlash(r, FlashDanger(gettext("Version does not exist.")))
+		} else if err := V.revert(r.Context(), rowid, current, vs[i].state); err != nil {
+			V.AddFlash(r, FlashError(err))
+		} else {
+			V.AddFlash(r, FlashSuccess(gettext("Record was reverted to version %d.", vs[i].Number)))
+		}
+		http.Redirect(w, r, must(V.Blueprint.GetUrl(".history_view", "id", rowid)), http.StatusFound)
+		return
+	}
+
+	slices.Reverse(vs)
+	V.Render(w, r, "model_history.gotmpl", nil, map[string]any{
+		"versions":   vs,
+		"request":    rd(r),
+		"csrf_field": csrf.TemplateField(r),
+	})
+}
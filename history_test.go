@@ -0,0 +1,77 @@
+package gadm
+
+import (
+	"gadm/examples/sqla"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Audit().SetDB(db)
+	admin.AddView(NewModelView(sqla.Company{}, db).
+		SetColumnEditableList("name").
+		SetRequiredRoles(PermEdit, "editor"))
+	admin.freeze()
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	admin.Security().AddRoles(alice, "editor")
+	admin.Security().CreateUser("bob@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	c.post("/admin/company/new", "/admin/company/new", url.Values{"name": {"Acme"}})
+	c.post("/admin/company/edit?id=1", "/admin/company/edit?id=1", url.Values{"name": {"Acme Inc"}})
+	c.post("/admin/company/", "/admin/company/ajax/update", url.Values{"list_form_pk": {"1"}, "name": {"Oops"}})
+
+	is.Contains(c.do("GET", "/admin/company/details?id=1", nil).Body.String(), `href="/admin/company/history?id=1"`)
+
+	w := c.do("GET", "/admin/company/history?id=1", nil)
+	is.Equal(200, w.Code)
+	body := w.Body.String()
+	is.Contains(body, "<del class=\"text-danger\">Acme Inc</del>")
+	is.Contains(body, "<ins class=\"text-success\">Oops</ins>")
+	is.Contains(body, "Revert to this version")
+
+	vs, _, err := admin.FindView("company").(*ModelView).versions(t.Context(), "1")
+	is.Nil(err)
+	is.Len(vs, 3)
+	is.True(vs[0].Revertable)
+	is.True(vs[1].Revertable)
+	is.False(vs[2].Revertable, "current")
+
+	// bob can not edit
+	cb := newTestClient(admin)
+	cb.post("/admin/login", "/admin/login", url.Values{"email": {"bob@example.com"}, "password": {"secret"}})
+	w = cb.do("GET", "/admin/company/history?id=1", nil)
+	is.Equal(200, w.Code)
+	is.NotContains(w.Body.String(), "Revert to this version")
+	w = cb.post("/admin/company/history?id=1", "/admin/company/history?id=1",
+		url.Values{"version": {strconv.Itoa(vs[1].Id)}})
+	is.Equal(403, w.Code)
+
+	// revert the inline edit
+	w = c.post("/admin/company/history?id=1", "/admin/company/history?id=1",
+		url.Values{"version": {strconv.Itoa(vs[1].Id)}})
+	is.Equal(302, w.Code)
+	var co sqla.Company
+	db.First(&co, 1)
+	is.Equal("Acme Inc", co.Name)
+
+	// revert is a change too
+	vs, _, _ = admin.FindView("company").(*ModelView).versions(t.Context(), "1")
+	is.Len(vs, 4)
+	is.Equal(AuditUpdate, vs[3].Action)
+	is.Equal("alice@example.com", vs[3].User)
+
+	// back to the first version
+	c.post("/admin/company/history?id=1", "/admin/company/history?id=1",
+		url.Values{"version": {strconv.Itoa(vs[0].Id)}})
+	db.First(&co, 1)
+	is.Equal("Acme", co.Name)
+}
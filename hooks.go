@@ -0,0 +1,89 @@
+package gadm
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Called around create and update, created is true for create.
+// row.Map holds the changes, row.Fields the current record.
+// Return error to veto the operation, the error is flashed.
+type ModelHook func(ctx context.Context, row *Row, created bool) error
+
+// Called for each record before delete, return error to veto
+type DeleteHook func(ctx context.Context, row *Row) error
+
+type modelHooks struct {
+	on_model_change    []ModelHook
+	after_model_change []ModelHook
+	on_model_delete    []DeleteHook
+}
+
+// Before the record is written, changes to row.Map are written too
+func (V *ModelView) OnModelChange(hooks ...ModelHook) *ModelView {
+	V.hooks.on_model_change = append(V.hooks.on_model_change, hooks...)
+	return V
+}
+
+// After the record is written, in the same transaction
+func (V *ModelView) AfterModelChange(hooks ...ModelHook) *ModelView {
+	V.hooks.after_model_change = append(V.hooks.after_model_change, hooks...)
+	return V
+}
+
+// Before each record is deleted
+func (V *ModelView) OnModelDelete(hooks ...DeleteHook) *ModelView {
+	V.hooks.on_model_delete = append(V.hooks.on_model_delete, hooks...)
+	return V
+}
+
+// Record of rowid with all fields, nil when not found or rowid is malformed
+func (V *ModelView) loadRow(tx *gorm.DB, rowid string) (*Row, error) {
+	ptr := V.Model.new()
+	if err := V.take(tx, rowid, ptr); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return NewRow(V.Model.Fields, ptr), nil
+}
+
+// Current record of rowid into row.Fields, changes in row.Map are kept
+func (V *ModelView) withCurrent(tx *gorm.DB, rowid string, row *Row) (*Row, error) {
+	cur, err := V.loadRow(tx, rowid)
+	if err != nil || cur == nil {
+		return row, err
+	}
+	cur.Map = row.Map
+	return cur, nil
+}
+
+func (V *ModelView) onModelChange(ctx context.Context, row *Row, created bool) error {
+	for _, fn := range V.hooks.on_model_change {
+		if err := fn(ctx, row, created); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (V *ModelView) afterModelChange(ctx context.Context, row *Row, created bool) error {
+	for _, fn := range V.hooks.after_model_change {
+		if err := fn(ctx, row, created); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (V *ModelView) onModelDelete(ctx context.Context, row *Row) error {
+	for _, fn := range V.hooks.on_model_delete {
+		if err := fn(ctx, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package gadm
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelHooks(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	type call struct {
+		id      uint
+		created bool
+	}
+	var calls []call
+	admin.AddView(NewModelView(Gadget{}, db).
+		SetColumnEditableList("stock").
+		OnModelChange(func(ctx context.Context, row *Row, created bool) error {
+			if created {
+				// stamp owner
+				row.Map["code"] = ctx.Value(userKey{}).(*BaseUser).Email
+				return nil
+			}
+			if row.Get("code") == "CLOSED" {
+				return errors.New("Record is closed.")
+			}
+			return nil
+		}).
+		AfterModelChange(func(ctx context.Context, row *Row, created bool) error {
+			calls = append(calls, call{cast.ToUint(row.Get("id")), created})
+			return nil
+		}).
+		OnModelDelete(func(ctx context.Context, row *Row) error {
+			if cast.ToInt(row.Get("stock")) > 0 {
+				return errors.New("Still in stock.")
+			}
+			return nil
+		}))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	is.Equal(302, c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"name": {"Gear"}, "stock": {"2"}}).Code)
+	var g Gadget
+	db.First(&g, 1)
+	is.Equal("alice@example.com", g.Code)
+	is.Equal([]call{{1, true}}, calls)
+
+	is.Equal(302, c.post("/admin/gadget/edit?id=1", "/admin/gadget/edit?id=1", url.Values{"name": {"Cog"}}).Code)
+	is.Equal([]call{{1, true}, {1, false}}, calls)
+
+	// veto edit of closed record
+	db.Model(&g).Update("code", "CLOSED")
+	w := c.post("/admin/gadget/edit?id=1", "/admin/gadget/edit?id=1", url.Values{"name": {"Wheel"}})
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "Failed to update record. Record is closed.")
+	db.First(&g, 1)
+	is.Equal("Cog", g.Name)
+
+	w = c.post("/admin/gadget/", "/admin/gadget/ajax/update", url.Values{"list_form_pk": {"1"}, "stock": {"5"}})
+	is.Equal(500, w.Code)
+	is.Contains(w.Body.String(), "Record is closed.")
+	is.Len(calls, 2)
+
+	// veto delete, one and batch
+	c.post("/admin/gadget/", "/admin/gadget/delete", url.Values{"id": {"1"}})
+	is.Contains(c.do("GET", "/admin/gadget/", nil).Body.String(), "Failed to delete record. Still in stock.")
+	db.Create(&Gadget{Name: "Empty"})
+	c.post("/admin/gadget/", "/admin/gadget/action", url.Values{"action": {"delete"}, "rowid": {"1", "2"}})
+	is.Contains(c.do("GET", "/admin/gadget/", nil).Body.String(), "Still in stock.")
+	var n int64
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(2), n, "nothing deleted")
+
+	c.post("/admin/gadget/", "/admin/gadget/delete", url.Values{"id": {"2"}})
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(1), n)
+
+	// malformed id is not passed to the hook, first record would veto
+	db.Create(&Gadget{Name: "Spare"})
+	c.post("/admin/gadget/", "/admin/gadget/action", url.Values{"action": {"delete"}, "rowid": {"3", "7,7"}})
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(1), n)
+	is.NotContains(c.do("GET", "/admin/gadget/", nil).Body.String(), "Still in stock.")
+}
@@ -0,0 +1,665 @@
+package gadm
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Rows shown in preview of import
+const importPreviewRows = 10
+
+// Uploaded files not committed are removed after
+const importExpiry = 24 * time.Hour
+
+// Import of CSV or XLSX file on the import page, like the create form for each row.
+// Valid rows are committed in one transaction, the rejected are in a report.
+func (V *ModelView) SetCanImport(v bool) *ModelView {
+	V.can_import = v
+	return V
+}
+
+// Uploaded file, kept in temp dir between the steps of import
+type importFile struct {
+	UserId int
+	// endpoint of model view
+	Endpoint string
+	Name     string
+	Header   []string
+	Rows     [][]string
+}
+
+// Rejected rows in CSV, only for the user and view of the import
+type importReport struct {
+	UserId   int
+	Endpoint string
+	Csv      []byte
+}
+
+func importPath(id, suffix string) (string, error) {
+	if bs, err := hex.DecodeString(id); err != nil || len(bs) != 16 {
+		return "", errors.New(gettext("Uploaded file has expired, please upload again."))
+	}
+	return filepath.Join(os.TempDir(), "gadm-import-"+id+suffix), nil
+}
+
+func newImportId() string {
+	bs := make([]byte, 16)
+	rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+// Remove files of imports left in temp dir
+func cleanImportFiles(now time.Time) {
+	ps, _ := filepath.Glob(filepath.Join(os.TempDir(), "gadm-import-*"))
+	for _, p := range ps {
+		if fi, err := os.Stat(p); err == nil && now.Sub(fi.ModTime()) > importExpiry {
+			os.Remove(p)
+		}
+	}
+}
+
+func writeImportJson(id, suffix string, v any) error {
+	p, err := importPath(id, suffix)
+	if err != nil {
+		return err
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, bs, 0o600)
+}
+
+// Error if missing or expired
+func readImportJson(id, suffix string, v any) error {
+	p, err := importPath(id, suffix)
+	if err != nil {
+		return err
+	}
+	expired := errors.New(gettext("Uploaded file has expired, please upload again."))
+	fi, err := os.Stat(p)
+	if err != nil || time.Since(fi.ModTime()) > importExpiry {
+		return expired
+	}
+	bs, err := os.ReadFile(p)
+	if err != nil || json.Unmarshal(bs, v) != nil {
+		return expired
+	}
+	return nil
+}
+
+func (f *importFile) save() (string, error) {
+	cleanImportFiles(time.Now())
+	id := newImportId()
+	return id, writeImportJson(id, ".json", f)
+}
+
+// Uploaded file of the user to the view
+func loadImportFile(id string, userId int, endpoint string) (*importFile, error) {
+	var f importFile
+	if err := readImportJson(id, ".json", &f); err != nil {
+		return nil, err
+	}
+	if f.UserId != userId || f.Endpoint != endpoint {
+		return nil, errors.New(gettext("Uploaded file has expired, please upload again."))
+	}
+	return &f, nil
+}
+
+// Header and rows of CSV or XLSX, by extension of name
+func readTable(name string, bs []byte) (*importFile, error) {
+	var records [][]string
+	var err error
+	if strings.EqualFold(filepath.Ext(name), ".xlsx") {
+		records, err = readXlsx(bs)
+	} else {
+		cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(bs, []byte("\xef\xbb\xbf"))))
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		records, err = cr.ReadAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New(gettext("The file is empty."))
+	}
+	return &importFile{Name: name, Header: records[0], Rows: records[1:]}, nil
+}
+
+// Cells of the first sheet, dates formatted as 2006-01-02 15:04:05
+func readXlsx(bs []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(bs), int64(len(bs)))
+	if err != nil {
+		return nil, err
+	}
+	read := func(name string, v any) error {
+		f, err := zr.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return xml.NewDecoder(f).Decode(v)
+	}
+
+	type text struct {
+		T string `xml:"t"`
+		R []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	}
+	join := func(t text) string {
+		s := t.T
+		for _, r := range t.R {
+			s += r.T
+		}
+		return s
+	}
+
+	// first sheet of workbook
+	path := "xl/worksheets/sheet1.xml"
+	var wb struct {
+		Sheets []struct {
+			Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Rels []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if read("xl/workbook.xml", &wb) == nil && read("xl/_rels/workbook.xml.rels", &rels) == nil && len(wb.Sheets) > 0 {
+		for _, rel := range rels.Rels {
+			if rel.Id == wb.Sheets[0].Id {
+				path = strings.TrimPrefix(rel.Target, "/")
+				if !strings.HasPrefix(path, "xl/") {
+					path = "xl/" + path
+				}
+			}
+		}
+	}
+
+	var sst struct {
+		Items []text `xml:"si"`
+	}
+	read("xl/sharedStrings.xml", &sst)
+
+	var styles struct {
+		NumFmts []struct {
+			Id   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		Xfs []struct {
+			NumFmtId int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	read("xl/styles.xml", &styles)
+	isDate := func(style int) bool {
+		if style < 0 || style >= len(styles.Xfs) {
+			return false
+		}
+		id := styles.Xfs[style].NumFmtId
+		if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) {
+			return true
+		}
+		for _, nf := range styles.NumFmts {
+			if nf.Id == id {
+				return isDateFormat(nf.Code)
+			}
+		}
+		return false
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref   string `xml:"r,attr"`
+				Type  string `xml:"t,attr"`
+				Style int    `xml:"s,attr"`
+				V     string `xml:"v"`
+				Is    text   `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := read(path, &sheet); err != nil {
+		return nil, err
+	}
+
+	records := [][]string{}
+	for _, row := range sheet.Rows {
+		record := []string{}
+		for _, c := range row.Cells {
+			if i := cellColumn(c.Ref); i >= len(record) {
+				record = append(record, make([]string, i-len(record))...)
+			}
+			v := c.V
+			switch c.Type {
+			case "s":
+				if i, err := strconv.Atoi(c.V); err == nil && i < len(sst.Items) {
+					v = join(sst.Items[i])
+				}
+			case "inlineStr":
+				v = join(c.Is)
+			case "b":
+				v = lo.Ternary(c.V == "1", "true", "false")
+			case "", "n":
+				if f, err := strconv.ParseFloat(c.V, 64); err == nil && isDate(c.Style) {
+					v = fromExcelTime(f)
+				}
+			}
+			record = append(record, v)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Index of column in reference like AB12, -1 without reference
+func cellColumn(ref string) int {
+	i := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		i = i*26 + int(c-'A'+1)
+	}
+	return i - 1
+}
+
+// Format of number is date or time, like yyyy-mm-dd, without quoted text and [colors]
+func isDateFormat(code string) bool {
+	var b strings.Builder
+	quoted, bracket := false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '[' && !quoted:
+			bracket = true
+		case c == ']' && !quoted:
+			bracket = false
+		case !quoted && !bracket:
+			b.WriteRune(c)
+		}
+	}
+	s := b.String()
+	return s != "general" && strings.ContainsAny(s, "ymdhs")
+}
+
+func fromExcelTime(days float64) string {
+	t := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).
+		Add(time.Duration(math.Round(days*86400)) * time.Second)
+	if days == math.Trunc(days) {
+		return t.Format(time.DateOnly)
+	}
+	return t.Format(time.DateTime)
+}
+
+// Primary keys and fields of create form
+func (V *ModelView) importFields() []*Field {
+	fs := V.pkFields()
+	for _, f := range V.fsNew {
+		if f.DBName != "" && !f.PrimaryKey {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// Field of each file column, matched by name or label when not mapped
+func (V *ModelView) importMapping(header []string, uv url.Values) []*Field {
+	fields := V.importFields()
+	norm := func(s string) string {
+		return strings.NewReplacer(" ", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(s)))
+	}
+	mapping := make([]*Field, len(header))
+	for i, h := range header {
+		key := fmt.Sprintf("map-%d", i)
+		mapping[i], _ = lo.Find(fields, func(f *Field) bool {
+			if uv.Has(key) {
+				return uv.Get(key) == f.DBName
+			}
+			return norm(h) == norm(f.DBName) || norm(h) == norm(f.Label)
+		})
+	}
+	return mapping
+}
+
+// One row of file to be imported
+type importRow struct {
+	// line in file, header is 1
+	Line   int
+	Values url.Values
+	// values of primary keys, Rowid when all given
+	Pk     url.Values
+	Rowid  string
+	Update bool
+	Errors formErrors
+}
+
+// Values of row by mapping, bool as true or false
+func (V *ModelView) importRowOf(line int, record []string, mapping []*Field) *importRow {
+	ir := &importRow{Line: line, Values: url.Values{}, Pk: url.Values{}, Errors: formErrors{}}
+	for i, f := range mapping {
+		if f == nil {
+			continue
+		}
+		v := ""
+		if i < len(record) {
+			v = strings.TrimSpace(record[i])
+		}
+		if f.DataType == schema.Bool && v != "" {
+			switch strings.ToLower(v) {
+			case "1", "t", "true", "y", "yes":
+				v = "true"
+			case "0", "f", "false", "n", "no":
+				v = "false"
+			default:
+				ir.Errors.add(f.DBName, gettext("Not a valid boolean value."))
+				continue
+			}
+		}
+		if f.PrimaryKey {
+			if v != "" {
+				ir.Pk.Set(f.DBName, v)
+			}
+			continue
+		}
+		ir.Values.Set(f.DBName, v)
+	}
+
+	if len(ir.Pk) == len(V.schema.PrimaryFields) {
+		ir.Rowid = strings.Join(lo.Map(V.schema.PrimaryFields, func(f *schema.Field, _ int) string {
+			return ir.Pk.Get(f.DBName)
+		}), ",")
+	}
+	maps.Copy(ir.Errors, checkFields(ir.Pk, V.pkFields(), false, nil))
+	return ir
+}
+
+func (V *ModelView) pkFields() []*Field {
+	return lo.Map(V.transform(V.schema.PrimaryFields), func(f *Field, _ int) *Field {
+		f.Readonly = false
+		return f
+	})
+}
+
+// Update when upsert and the record exists, validated as create or edit form.
+// Nil row when invalid.
+func (V *ModelView) checkImport(tx *gorm.DB, ir *importRow, upsert bool) (*Row, error) {
+	if upsert && ir.Rowid != "" && len(ir.Errors) == 0 {
+		ids, err := V.existing(tx, []string{ir.Rowid})
+		if err != nil {
+			return nil, err
+		}
+		ir.Update = len(ids) == 1
+	}
+	fields := lo.Ternary(ir.Update, V.fsEdit, V.fsNew)
+	maps.Copy(ir.Errors, V.validate(ir.Values, fields, !ir.Update))
+	if len(ir.Errors) > 0 {
+		return nil, nil
+	}
+
+	row := V.intoRow(ir.Values, fields)
+	if !ir.Update && ir.Rowid != "" {
+		// given primary key of new record
+		maps.Copy(row.Map, V.intoRow(ir.Pk, V.pkFields()).Map)
+	}
+	return row, nil
+}
+
+// All messages of errors, in order of column
+func (fe formErrors) join() string {
+	ss := []string{}
+	for _, f := range slices.Sorted(maps.Keys(fe)) {
+		ss = append(ss, f+": "+strings.Join(fe[f], " "))
+	}
+	return strings.Join(ss, "; ")
+}
+
+// Rejected row and the reason
+type importReject struct {
+	Line   int
+	Record []string
+	Reason string
+}
+
+// Rows are created and updated with the permissions of the forms
+func (V *ModelView) importAllowed(r *http.Request, ir *importRow) error {
+	if ir.Update && !V.can(r, PermEdit) {
+		return errors.New(gettext("Not allowed to update records."))
+	}
+	if !ir.Update && !V.can(r, PermCreate) {
+		return errors.New(gettext("Not allowed to create records."))
+	}
+	return nil
+}
+
+// Create or update valid rows in one transaction, each row in a savepoint
+func (V *ModelView) importRows(r *http.Request, f *importFile, mapping []*Field, upsert bool) (created, updated int, rejects []importReject, err error) {
+	err = V.transaction(r.Context(), func(ctx context.Context, tx *gorm.DB) error {
+		for i, record := range f.Rows {
+			ir := V.importRowOf(i+2, record, mapping)
+			row, err := V.checkImport(tx, ir, upsert)
+			if err != nil {
+				return err
+			}
+			if err = V.importAllowed(r, ir); err != nil {
+				rejects = append(rejects, importReject{ir.Line, record, err.Error()})
+				continue
+			}
+			switch {
+			case row == nil:
+				err = errors.New(ir.Errors.join())
+			case ir.Update:
+				err = V.update(ctx, ir.Rowid, row)
+			default:
+				err = V.create(ctx, row)
+			}
+			if err != nil {
+				rejects = append(rejects, importReject{ir.Line, record, err.Error()})
+				continue
+			}
+			if ir.Update {
+				updated++
+			} else {
+				created++
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Report of rejected rows in CSV: line, columns of file and error
+func writeImportReport(w io.Writer, header []string, rejects []importReject) error {
+	cw := csv.NewWriter(w)
+	cw.Write(append(append([]string{"line"}, header...), "error"))
+	for _, rj := range rejects {
+		record := make([]string, len(header))
+		copy(record, rj.Record)
+		cw.Write(append(append([]string{strconv.Itoa(rj.Line)}, record...), rj.Reason))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Converted values of a row in preview
+type importPreview struct {
+	Line   int
+	Action string
+	Cells  []string
+	Error  string
+}
+
+func (V *ModelView) previewImport(r *http.Request, f *importFile, mapping []*Field, upsert bool) ([]*importPreview, error) {
+	ps := []*importPreview{}
+	for i, record := range f.Rows[:min(len(f.Rows), importPreviewRows)] {
+		ir := V.importRowOf(i+2, record, mapping)
+		row, err := V.checkImport(V.Tx(r.Context()), ir, upsert)
+		if err != nil {
+			return nil, err
+		}
+		p := &importPreview{Line: ir.Line, Action: lo.Ternary(ir.Update, gettext("Update"), gettext("Create"))}
+		for _, mf := range mapping {
+			switch {
+			case mf == nil:
+				continue
+			case mf.PrimaryKey:
+				p.Cells = append(p.Cells, ir.Pk.Get(mf.DBName))
+			case row == nil:
+				p.Cells = append(p.Cells, ir.Values.Get(mf.DBName))
+			default:
+				// converted value, absent is null
+				v, ok := row.Map[mf.DBName]
+				p.Cells = append(p.Cells, lo.Ternary(ok, fmt.Sprint(v), "NULL"))
+			}
+		}
+		if row == nil {
+			p.Error = ir.Errors.join()
+		}
+		if err := V.importAllowed(r, ir); err != nil {
+			p.Error = err.Error()
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+func (V *ModelView) currentUserId(r *http.Request) int {
+	if u := V.admin.security.CurrentUser(r); u != nil {
+		return u.Id
+	}
+	return 0
+}
+
+// Upload, map columns and preview, then commit.
+//
+//	POST file         parse the file, match columns and preview
+//	POST id, map-i    preview with the mapping, commit when action=commit
+func (V *ModelView) importHandler(w http.ResponseWriter, r *http.Request) {
+	if !V.can(r, PermImport) {
+		V.redirect(w, r)
+		return
+	}
+	data := map[string]any{
+		"step":       "upload",
+		"request":    rd(r),
+		"csrf_field": csrf.TemplateField(r),
+	}
+	if r.Method == http.MethodPost {
+		if err := V.importStep(r, data); err != nil {
+			V.AddFlash(r, FlashDanger(err.Error()))
+			data["step"] = "upload"
+		}
+	}
+	V.Render(w, r, "model_import.gotmpl", nil, data)
+}
+
+func (V *ModelView) importStep(r *http.Request, data map[string]any) error {
+	uid := V.currentUserId(r)
+	var f *importFile
+	id := r.PostFormValue("id")
+	if file, fh, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		bs, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		if f, err = readTable(fh.Filename, bs); err != nil {
+			return fmt.Errorf("%s: %w", gettext("Failed to read the file."), err)
+		}
+		f.UserId, f.Endpoint = uid, V.Blueprint.Endpoint
+		if id, err = f.save(); err != nil {
+			return err
+		}
+	} else if f, err = loadImportFile(id, uid, V.Blueprint.Endpoint); err != nil {
+		return err
+	}
+
+	mapping := V.importMapping(f.Header, r.PostForm)
+	upsert := r.PostFormValue("upsert") != ""
+	if !slices.ContainsFunc(mapping, func(f *Field) bool { return f != nil }) {
+		return errors.New(gettext("No column of the file matches a field."))
+	}
+
+	if r.PostFormValue("action") == "commit" {
+		created, updated, rejects, err := V.importRows(r, f, mapping, upsert)
+		if err != nil {
+			return err
+		}
+		p, _ := importPath(id, ".json")
+		os.Remove(p)
+		if len(rejects) > 0 {
+			var b bytes.Buffer
+			writeImportReport(&b, f.Header, rejects)
+			if err := writeImportJson(id, "-rejected.json",
+				&importReport{UserId: uid, Endpoint: V.Blueprint.Endpoint, Csv: b.Bytes()}); err != nil {
+				return err
+			}
+			data["report_url"] = must(V.Blueprint.GetUrl(".import_report", "id", id))
+		}
+		V.AddFlash(r, FlashInfo(gettext("%d records were created, %d were updated and %d were rejected.",
+			created, updated, len(rejects))))
+		data["step"] = "done"
+		data["rejects"] = rejects
+		data["header"] = f.Header
+		return nil
+	}
+
+	previews, err := V.previewImport(r, f, mapping, upsert)
+	if err != nil {
+		return err
+	}
+	data["step"] = "map"
+	data["id"] = id
+	data["file"] = f
+	data["mapping"] = mapping
+	data["fields"] = V.importFields()
+	data["upsert"] = upsert
+	data["previews"] = previews
+	data["preview_columns"] = lo.Compact(mapping)
+	return nil
+}
+
+// Download rejected rows of own import to the view in CSV
+func (V *ModelView) importReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !V.can(r, PermImport) {
+		V.redirect(w, r)
+		return
+	}
+	var report importReport
+	if err := readImportJson(r.URL.Query().Get("id"), "-rejected.json", &report); err != nil ||
+		report.UserId != V.currentUserId(r) || report.Endpoint != V.Blueprint.Endpoint {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Add("content-disposition", fmt.Sprintf("attachment;filename=%s-rejected.csv", V.name()))
+	w.Header().Add("content-type", "text/csv")
+	w.Write(report.Csv)
+}
@@ -0,0 +1,195 @@
+package gadm
+
+import (
+	"bytes"
+	"html"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Upload file with csrf token of the page
+func (c *testClient) upload(path, name string, content []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if m := csrfPattern.FindStringSubmatch(c.do("GET", path, nil).Body.String()); m != nil {
+		mw.WriteField("csrf_token", html.UnescapeString(m[1]))
+	}
+	fw, _ := mw.CreateFormFile("file", name)
+	fw.Write(content)
+	mw.Close()
+
+	r := httptest.NewRequest("POST", path, &body)
+	r.Header.Set("content-type", mw.FormDataContentType())
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, r)
+	return w
+}
+
+var importIdPattern = regexp.MustCompile(`name="id" value="([0-9a-f]+)"`)
+
+func TestImport(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Gadget{}, db).SetCanImport(true))
+	admin.AddView(NewModelView(Widget{}, db))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&Gadget{Name: "old", Stock: 1})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	is.Contains(c.do("GET", "/admin/gadget/", nil).Body.String(), `href="/admin/gadget/import"`)
+	is.NotContains(c.do("GET", "/admin/widget/", nil).Body.String(), `/import"`)
+	is.Equal(302, c.do("GET", "/admin/widget/import", nil).Code)
+
+	csv := "ID,Name,Stock,price,Note\n1,gear,5,2.5,x\n,cog,7,1,y\n,toolongname,1,1,z\n,bolt,abc,1,w\n"
+	w := c.upload("/admin/gadget/import", "gadgets.csv", []byte(csv))
+	is.Equal(200, w.Code)
+	body := w.Body.String()
+	// matched by name and label
+	is.Contains(body, `<option value="id" selected>`)
+	is.Contains(body, `<option value="price" selected>`)
+	is.Regexp(`name="map-4">\s*<option value="">`, body)
+	is.NotRegexp(`name="map-4">[^/]*selected`, body)
+	// converted values and errors
+	is.Contains(body, "<td>gear</td>\n        <td>5</td>\n        <td>2.5</td>")
+	is.Contains(body, "stock: Not a valid integer value.")
+	is.Contains(body, "name: Field cannot be longer than 8 characters.")
+	id := importIdPattern.FindStringSubmatch(body)[1]
+
+	form := url.Values{"id": {id}, "map-0": {"id"}, "map-1": {"name"}, "map-2": {"stock"}, "map-3": {"price"}, "map-4": {""}}
+	// preview of upsert
+	form.Set("upsert", "1")
+	form.Set("action", "preview")
+	body = c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String()
+	is.Contains(body, "<td>2</td>\n        <td>Update</td>")
+	var n int64
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(1), n)
+
+	form.Set("action", "commit")
+	body = c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String()
+	is.Contains(body, "1 records were created, 1 were updated and 2 were rejected.")
+	var gs []Gadget
+	db.Order("id").Find(&gs)
+	is.Len(gs, 2)
+	is.Equal("gear", gs[0].Name)
+	is.Equal(5, gs[0].Stock)
+	is.Equal(2.5, gs[0].Price)
+	is.Equal("cog", gs[1].Name)
+
+	// report of rejected rows
+	m := regexp.MustCompile(`href="(/admin/gadget/import/report\?id=[0-9a-f]+)"`).FindStringSubmatch(body)
+	is.NotNil(m)
+	w = c.do("GET", html.UnescapeString(m[1]), nil)
+	is.Equal("text/csv", w.Header().Get("content-type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	is.Equal("line,ID,Name,Stock,price,Note,error", lines[0])
+	is.Equal("4,,toolongname,1,1,z,name: Field cannot be longer than 8 characters.", lines[1])
+	is.Equal("5,,bolt,abc,1,w,stock: Not a valid integer value.", lines[2])
+
+	// report is only for the user who imported
+	admin.Security().CreateUser("bob@example.com", "secret")
+	bob := newTestClient(admin)
+	bob.post("/admin/login", "/admin/login", url.Values{"email": {"bob@example.com"}, "password": {"secret"}})
+	w = bob.do("GET", html.UnescapeString(m[1]), nil)
+	is.Equal(404, w.Code)
+	is.NotContains(w.Body.String(), "toolongname")
+
+	// committed file is removed
+	form.Set("action", "preview")
+	is.Contains(c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String(), "Uploaded file has expired")
+
+	// without upsert, existing primary key is rejected by db
+	body = c.upload("/admin/gadget/import", "again.csv", []byte("id,name\n1,dup\n")).Body.String()
+	form = url.Values{"id": {importIdPattern.FindStringSubmatch(body)[1]}, "map-0": {"id"}, "map-1": {"name"}, "action": {"commit"}}
+	is.Contains(c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String(), "0 records were created, 0 were updated and 1 were rejected.")
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(2), n)
+}
+
+func TestReadXlsx(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Shipment{}, db))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&Shipment{Name: "box & co", Weight: 1.5, Count: 3, ShippedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	w := c.do("GET", "/admin/shipment/export?export_type=xlsx", nil)
+
+	f, err := readTable("shipment.xlsx", w.Body.Bytes())
+	is.Nil(err)
+	is.Equal([]string{"id", "name", "weight", "count", "shipped_at", "note"}, f.Header)
+	is.Equal([][]string{{"1", "box & co", "1.5", "3", "2024-03-01 12:00:00"}}, f.Rows)
+
+	is.True(isDateFormat(`yyyy\-mm\-dd`))
+	is.True(isDateFormat(`[$-409]d/m/yy h:mm AM/PM;@`))
+	is.False(isDateFormat(`0.00"days"`))
+	is.False(isDateFormat(`General`))
+	is.Equal(0, cellColumn("A1"))
+	is.Equal(27, cellColumn("AB12"))
+}
+
+func TestImportPermissions(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Gadget{}, db).SetCanImport(true).SetCanEdit(false))
+	admin.AddView(NewModelView(Shipment{}, db).SetCanImport(true))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&Gadget{Name: "old", Stock: 1})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	// update is not allowed without edit permission
+	body := c.upload("/admin/gadget/import", "gadgets.csv", []byte("id,name\n1,gear\n,cog\n")).Body.String()
+	form := url.Values{"id": {importIdPattern.FindStringSubmatch(body)[1]}, "map-0": {"id"}, "map-1": {"name"}, "upsert": {"1"}, "action": {"preview"}}
+	is.Contains(c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String(), "Not allowed to update records.")
+	form.Set("action", "commit")
+	is.Contains(c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String(), "1 records were created, 0 were updated and 1 were rejected.")
+	var gs []Gadget
+	db.Order("id").Find(&gs)
+	is.Equal("old", gs[0].Name)
+	is.Equal("cog", gs[1].Name)
+
+	// file and report of import are for the view only
+	body = c.upload("/admin/gadget/import", "gadgets.csv", []byte("name\ntoolongname\n")).Body.String()
+	form = url.Values{"id": {importIdPattern.FindStringSubmatch(body)[1]}, "map-0": {"name"}, "action": {"preview"}}
+	is.Contains(c.post("/admin/shipment/import", "/admin/shipment/import", form).Body.String(), "Uploaded file has expired")
+	form.Set("action", "commit")
+	body = c.post("/admin/gadget/import", "/admin/gadget/import", form).Body.String()
+	report := regexp.MustCompile(`/admin/gadget/import/report\?id=([0-9a-f]+)`).FindStringSubmatch(body)
+	is.NotNil(report)
+	is.Equal(200, c.do("GET", "/admin/gadget/import/report?id="+report[1], nil).Code)
+	is.Equal(404, c.do("GET", "/admin/shipment/import/report?id="+report[1], nil).Code)
+
+	// too large upload
+	admin.SetMaxBodySize(1 << 10)
+	is.Equal(413, c.upload("/admin/gadget/import", "big.csv", bytes.Repeat([]byte("name\n"), 1<<10)).Code)
+
+	// left files expire
+	p, _ := importPath(newImportId(), ".json")
+	is.Nil(os.WriteFile(p, []byte("{}"), 0o600))
+	cleanImportFiles(time.Now())
+	is.FileExists(p)
+	cleanImportFiles(time.Now().Add(importExpiry + time.Minute))
+	is.NoFileExists(p)
+}
@@ -0,0 +1,254 @@
+package gadm
+
+import (
+	"context"
+	"log"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/camelcase"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Child model of has many, edited inside the parent form
+type inlineModel struct {
+	model    *Model
+	relation *schema.Relationship
+	// prefix of inputs, like addresses-0-number
+	name  string
+	label string
+	pk    *schema.Field
+	// editable, without primary key and the foreign key to parent
+	fields []*Field
+}
+
+// Edit children of has many inline in create and edit form, like flask-admin inline_models.
+// Added, changed and removed children are saved in the transaction of parent.
+func (V *ModelView) SetInlineModels(models ...any) *ModelView {
+	for _, m := range models {
+		im := V.inlineOf(m)
+		if im == nil {
+			log.Printf("no has many relation of %T in %s", m, V.schema.Name)
+			continue
+		}
+		V.inline_models = append(V.inline_models, im)
+	}
+	return V
+}
+
+func (V *ModelView) inlineOf(m any) *inlineModel {
+	t := reflect.Indirect(reflect.ValueOf(m)).Type()
+	for _, rel := range V.schema.Relationships.HasMany {
+		if rel.FieldSchema.ModelType != t || rel.Polymorphic != nil || len(rel.References) != 1 {
+			continue
+		}
+		child := NewModel(m)
+		pk := child.schema.PrioritizedPrimaryField
+		if pk == nil {
+			return nil
+		}
+		fk := rel.References[0].ForeignKey
+		return &inlineModel{
+			model:    child,
+			relation: rel,
+			name:     Namer.ColumnName("", rel.Name),
+			label:    strings.Join(camelcase.Split(rel.Name), " "),
+			pk:       pk,
+			fields: clone(slices.DeleteFunc(slices.Clone(child.Fields), func(f *Field) bool {
+				return f.DBName == "" || f.PrimaryKey || f.Field.Name == fk.Name
+			})),
+		}
+	}
+	return nil
+}
+
+// One submitted child, by index in form
+type inlineEntry struct {
+	inline  *inlineModel
+	prefix  string
+	pk      string
+	deleted bool
+	// without prefix
+	values url.Values
+}
+
+// Submitted children in order of index, prefix-i-column and del-prefix-i
+func (im *inlineModel) entries(uv url.Values) []*inlineEntry {
+	byIndex := map[int]url.Values{}
+	for k, vs := range uv {
+		rest, ok := strings.CutPrefix(k, im.name+"-")
+		if !ok {
+			continue
+		}
+		idx, col, ok := strings.Cut(rest, "-")
+		i, err := strconv.Atoi(idx)
+		if !ok || err != nil {
+			continue
+		}
+		if byIndex[i] == nil {
+			byIndex[i] = url.Values{}
+		}
+		byIndex[i][col] = vs
+	}
+
+	es := []*inlineEntry{}
+	for _, i := range slices.Sorted(maps.Keys(byIndex)) {
+		prefix := im.name + "-" + strconv.Itoa(i)
+		es = append(es, &inlineEntry{
+			inline:  im,
+			prefix:  prefix,
+			pk:      byIndex[i].Get(im.pk.DBName),
+			deleted: uv.Has("del-" + prefix),
+			values:  byIndex[i],
+		})
+	}
+	return es
+}
+
+func (V *ModelView) inlineEntries(uv url.Values) []*inlineEntry {
+	es := []*inlineEntry{}
+	for _, im := range V.inline_models {
+		es = append(es, im.entries(uv)...)
+	}
+	return es
+}
+
+// Validate submitted children, errors by prefixed name
+func (V *ModelView) validateInlines(uv url.Values, errs formErrors) {
+	for _, e := range V.inlineEntries(uv) {
+		if e.deleted {
+			continue
+		}
+		for name, msgs := range checkFields(e.values, e.inline.fields, e.pk == "", nil) {
+			errs[e.prefix+"-"+name] = msgs
+		}
+	}
+}
+
+// Add, update and delete children of record, inside tx
+func (V *ModelView) saveInlines(ctx context.Context, tx *gorm.DB, rowid string, row *Row) error {
+	if len(row.inlines) == 0 {
+		return nil
+	}
+	ptr := V.Model.new()
+	if err := V.take(tx, rowid, ptr); err != nil {
+		return err
+	}
+
+	for _, e := range row.inlines {
+		im := e.inline
+		ref := im.relation.References[0]
+		parent, _ := ref.PrimaryKey.ValueOf(ctx, reflect.ValueOf(ptr).Elem())
+		owned := func() *gorm.DB {
+			return tx.Model(im.model.new()).
+				Where(im.pk.DBName+" = ? AND "+ref.ForeignKey.DBName+" = ?", e.pk, parent)
+		}
+
+		var rc *gorm.DB
+		values := V.intoRow(e.values, im.fields).Map
+		switch {
+		case e.deleted && e.pk == "":
+			continue
+		case e.deleted:
+			rc = owned().Delete(im.model.new())
+		case e.pk != "":
+			if len(values) == 0 {
+				continue
+			}
+			rc = owned().Updates(values)
+		default:
+			values[ref.ForeignKey.DBName] = parent
+			rc = tx.Model(im.model.new()).Create(values)
+		}
+		if rc.Error != nil {
+			return rc.Error
+		}
+	}
+	return nil
+}
+
+// Children in form, one of inline models
+type inlineForm struct {
+	Name  string
+	Label string
+	// empty form for the template of new child
+	Form *modelForm
+	Rows []*inlineRow
+}
+
+type inlineRow struct {
+	Prefix  string
+	Number  int
+	Pk      string
+	PkName  string
+	Deleted bool
+	Form    *modelForm
+}
+
+// Inline forms of record, from submitted values when uv is not empty
+func (V *ModelView) inlineForms(ctx context.Context, rowid string, uv url.Values, errs formErrors) []*inlineForm {
+	ifs := []*inlineForm{}
+	for _, im := range V.inline_models {
+		f := &inlineForm{
+			Name:  im.name,
+			Label: im.label,
+			Form:  NewForm(im.fields, nil, ""),
+			Rows:  []*inlineRow{},
+		}
+
+		if len(uv) > 0 {
+			for _, e := range im.entries(uv) {
+				row := submitted(NewRow(im.fields, im.model.new()), e.values)
+				f.Rows = append(f.Rows, im.row(e.prefix, e.pk, row, errs))
+				f.Rows[len(f.Rows)-1].Deleted = e.deleted
+			}
+		} else {
+			for i, child := range V.children(ctx, rowid, im) {
+				pk, _ := im.pk.ValueOf(ctx, reflect.ValueOf(child).Elem())
+				prefix := im.name + "-" + strconv.Itoa(i)
+				f.Rows = append(f.Rows, im.row(prefix, cast.ToString(pk), NewRow(im.fields, child), nil))
+			}
+		}
+		for i, r := range f.Rows {
+			r.Number = i + 1
+		}
+		ifs = append(ifs, f)
+	}
+	return ifs
+}
+
+func (im *inlineModel) row(prefix, pk string, row *Row, errs formErrors) *inlineRow {
+	for _, f := range row.Fields {
+		f.Prefix = prefix
+	}
+	form := NewForm(im.fields, row, "")
+	form.Errors = errs
+	return &inlineRow{Prefix: prefix, Pk: pk, PkName: im.pk.DBName, Form: form}
+}
+
+// Children of record in the order of primary key
+func (V *ModelView) children(ctx context.Context, rowid string, im *inlineModel) []any {
+	if rowid == "" {
+		return nil
+	}
+	tx := V.Tx(ctx)
+	ptr := V.Model.new()
+	if err := V.take(tx, rowid, ptr); err != nil {
+		return nil
+	}
+	slice := reflect.New(reflect.SliceOf(reflect.PointerTo(im.model.schema.ModelType)))
+	if err := tx.Model(ptr).Order(im.pk.DBName).Association(im.relation.Name).Find(slice.Interface()); err != nil {
+		return nil
+	}
+	cs := []any{}
+	for i := 0; i < slice.Elem().Len(); i++ {
+		cs = append(cs, slice.Elem().Index(i).Interface())
+	}
+	return cs
+}
@@ -0,0 +1,83 @@
+package gadm
+
+import (
+	"context"
+	"errors"
+	"gadm/examples/sqla"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInlineModels(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&sqla.Address{})
+	admin.AddView(NewModelView(sqla.Account{}, db).
+		SetInlineModels(sqla.Address{}).
+		AfterModelChange(func(ctx context.Context, row *Row, created bool) error {
+			if row.Get("name") == "Broken" {
+				return errors.New("broken")
+			}
+			return nil
+		}))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	numbers := func() (ns []string) {
+		db.Model(&sqla.Address{}).Where("account_id = ?", 1).Order("id").Pluck("number", &ns)
+		return
+	}
+
+	body := c.do("GET", "/admin/account/new", nil).Body.String()
+	is.Contains(body, `<div class="inline-field" id="addresses">`)
+	is.Contains(body, `faForm.addInlineField(this, 'addresses')`)
+	// template of new child, escaped
+	is.Contains(body, `&lt;input class=&#34;form-control&#34; type=&#34;text&#34; id=&#34;number&#34; name=&#34;number&#34;`)
+	is.NotContains(body, `id=&#34;account_id&#34;`)
+
+	is.Equal(302, c.post("/admin/account/new", "/admin/account/new", url.Values{
+		"name":               {"Alice"},
+		"addresses-0-number": {"29-1"},
+		"addresses-1-number": {"30-2"},
+	}).Code)
+	is.Equal([]string{"29-1", "30-2"}, numbers())
+
+	body = c.do("GET", "/admin/account/edit?id=1", nil).Body.String()
+	is.Contains(body, `<input name="addresses-0-id" type="hidden" value="1">`)
+	is.Contains(body, `id="addresses-1-number" name="addresses-1-number"`)
+	is.Contains(body, `value="30-2"`)
+	is.Contains(body, `name="del-addresses-0"`)
+
+	// edit one, remove one and add one
+	is.Equal(302, c.post("/admin/account/edit?id=1", "/admin/account/edit?id=1", url.Values{
+		"name":               {"Alice"},
+		"addresses-0-id":     {"1"},
+		"addresses-0-number": {"29-9"},
+		"addresses-1-id":     {"2"},
+		"addresses-1-number": {"30-2"},
+		"del-addresses-1":    {"y"},
+		"addresses-2-number": {"31-3"},
+	}).Code)
+	is.Equal([]string{"29-9", "31-3"}, numbers())
+
+	// children of other records are untouched
+	db.Create(&sqla.Address{Id: 9, Number: "other", AccountID: 2})
+	c.post("/admin/account/edit?id=1", "/admin/account/edit?id=1", url.Values{
+		"name": {"Alice"}, "addresses-0-id": {"9"}, "addresses-0-number": {"mine"}, "del-addresses-0": {"y"}})
+	var other sqla.Address
+	db.First(&other, 9)
+	is.Equal("other", other.Number)
+
+	// rolled back with parent
+	w := c.post("/admin/account/edit?id=1", "/admin/account/edit?id=1", url.Values{
+		"name": {"Broken"}, "addresses-5-number": {"32-4"}})
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "Failed to update record. broken")
+	is.Contains(w.Body.String(), `name="addresses-5-number"`)
+	is.Equal([]string{"29-9", "31-3"}, numbers())
+}
@@ -0,0 +1,159 @@
+package gadm
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginLockout.Kind
+const (
+	lockAccount = "account"
+	lockIp      = "ip"
+)
+
+// Failures are forgotten after a quiet window
+const lockoutWindow = 24 * time.Hour
+
+// Failed login attempts of an account or an ip.
+// Delete the row to unlock.
+type LoginLockout struct {
+	Id int `gorm:"primaryKey"`
+	// account or ip
+	Kind string `gorm:"uniqueIndex:idx_login_lockout;not null;size:16"`
+	// email of account, or ip address
+	Identity      string `gorm:"uniqueIndex:idx_login_lockout;not null;size:255"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   null.Time
+}
+
+type lockout struct {
+	account_max int
+	ip_max      int
+	backoff     []time.Duration
+}
+
+var defaultLockout = lockout{
+	account_max: 5,
+	ip_max:      20,
+	backoff:     []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour},
+}
+
+// Lock an account after accountMax failures in a row, and an ip after ipMax.
+// Each following failure locks again for the next backoff, the last one repeats.
+// Zero max disables the counter.
+func (S *Security) SetLockout(accountMax, ipMax int, backoff ...time.Duration) *Security {
+	S.lockout = lockout{account_max: accountMax, ip_max: ipMax, backoff: backoff}
+	if len(backoff) == 0 {
+		S.lockout.backoff = defaultLockout.backoff
+	}
+	return S
+}
+
+// Built-in view of login lockouts, delete to unlock.
+// Requires role admin, change with SetAccessRoles.
+func (S *Security) LockoutView() *ModelView { return S.lockout_view }
+
+// Remote ip of request, without port
+func clientIp(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// email of the account, empty if not found
+func (S *Security) accountOf(identity string) string {
+	var u BaseUser
+	if identity == "" || S.db.Select("email").Where("email = ? OR username = ?", identity, identity).
+		First(&u).Error != nil {
+		return ""
+	}
+	return u.Email
+}
+
+// Error if account or ip is locked now
+func (S *Security) checkLockout(identity, ip string) error {
+	var ls []LoginLockout
+	S.db.Where("(kind = ? AND identity = ?) OR (kind = ? AND identity = ?)",
+		lockAccount, S.accountOf(identity), lockIp, ip).Find(&ls)
+
+	for _, l := range ls {
+		if l.LockedUntil.Valid && l.LockedUntil.Time.After(time.Now()) {
+			wait := time.Until(l.LockedUntil.Time).Round(time.Second)
+			return errors.New(gettext("Too many failed login attempts, try again in %s", wait))
+		}
+	}
+	return nil
+}
+
+// Count a failure, lock when reaching max
+func (S *Security) failLogin(identity, ip string) {
+	if email := S.accountOf(identity); email != "" {
+		S.countFailure(lockAccount, email, S.lockout.account_max)
+	}
+	S.countFailure(lockIp, ip, S.lockout.ip_max)
+}
+
+func (S *Security) countFailure(kind, identity string, max int) {
+	if max <= 0 || identity == "" {
+		return
+	}
+
+	S.db.Transaction(func(tx *gorm.DB) error {
+		l := LoginLockout{Kind: kind, Identity: identity}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(&l).FirstOrInit(&l).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if now.Sub(l.LastFailureAt) > lockoutWindow {
+			l.Failures = 0
+		}
+		l.Failures++
+		l.LastFailureAt = now
+		if n := l.Failures - max; n >= 0 {
+			d := S.lockout.backoff[min(n, len(S.lockout.backoff)-1)]
+			l.LockedUntil = null.TimeFrom(now.Add(d))
+		}
+		return tx.Save(&l).Error
+	})
+}
+
+// Clear counter of account after a successful login
+func (S *Security) resetLockout(u *BaseUser) {
+	S.Unlock(lockAccount, u.Email)
+}
+
+// Unlock account by email (kind "account"), or ip (kind "ip")
+func (S *Security) Unlock(kind, identity string) error {
+	return S.db.Where("kind = ? AND identity = ?", kind, identity).
+		Delete(&LoginLockout{}).Error
+}
+
+// Keep trackable fields of BaseUser
+func (S *Security) track(r *http.Request, u *BaseUser) error {
+	now := time.Now()
+	ip := null.StringFrom(clientIp(r))
+
+	u.LastLoginAt = emptyOr(u.CurrentLoginAt, null.TimeFrom(now))
+	u.LastLoginIp = emptyOr(u.CurrentLoginIp, ip)
+	u.CurrentLoginAt = null.TimeFrom(now)
+	u.CurrentLoginIp = ip
+	u.LoginCount++
+
+	return S.db.Model(u).Updates(map[string]any{
+		"last_login_at":    u.LastLoginAt,
+		"last_login_ip":    u.LastLoginIp,
+		"current_login_at": u.CurrentLoginAt,
+		"current_login_ip": u.CurrentLoginIp,
+		"login_count":      gorm.Expr("login_count + 1"),
+	}).Error
+}
@@ -0,0 +1,117 @@
+package gadm
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackable(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	login := func() {
+		c := newTestClient(admin)
+		w := c.post("/admin/login", "/admin/login", url.Values{
+			"email": {"alice@example.com"}, "password": {"secret"}})
+		is.Equal(302, w.Code)
+	}
+
+	login()
+	var u BaseUser
+	db.First(&u)
+	is.Equal(1, u.LoginCount)
+	is.Equal("192.0.2.1", u.CurrentLoginIp.String)
+	is.True(u.CurrentLoginAt.Valid)
+	is.Equal(u.CurrentLoginAt, u.LastLoginAt)
+
+	first := u.CurrentLoginAt
+	login()
+	db.First(&u)
+	is.Equal(2, u.LoginCount)
+	is.Equal(first.Time.Unix(), u.LastLoginAt.Time.Unix())
+	is.False(u.CurrentLoginAt.Time.Before(first.Time))
+}
+
+func TestLockout(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Security().SetLockout(3, 9, time.Minute, time.Hour)
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	admin.Security().AddRoles(alice, "admin")
+	u, _ := admin.Security().CreateUser("bob@example.com", "secret")
+	db.Model(u).Update("username", "bob")
+	admin.freeze()
+
+	c := newTestClient(admin)
+	login := func(identity, password string) int {
+		return c.post("/admin/login", "/admin/login", url.Values{
+			"email": {identity}, "password": {password}}).Code
+	}
+
+	is.Equal(401, login("alice@example.com", "wrong"))
+	is.Equal(401, login("alice@example.com", "wrong"))
+	// success clears the counter
+	is.Equal(302, login("alice@example.com", "secret"))
+	c.post("/admin/", "/admin/logout", url.Values{})
+
+	// by username, counted to the account
+	is.Equal(401, login("bob", "wrong"))
+	is.Equal(401, login("bob@example.com", "wrong"))
+	is.Equal(401, login("bob", "wrong"))
+	is.Equal(429, login("bob@example.com", "secret"))
+
+	var l LoginLockout
+	is.Nil(db.Where("kind = ? AND identity = ?", lockAccount, "bob@example.com").First(&l).Error)
+	is.Equal(3, l.Failures)
+	is.WithinDuration(time.Now().Add(time.Minute), l.LockedUntil.Time, 5*time.Second)
+
+	// listed in the built-in view, delete to unlock
+	ca := newTestClient(admin)
+	ca.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	w := ca.do("GET", "/admin/loginlockout/", nil)
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "bob@example.com")
+	is.NotContains(w.Body.String(), "alice@example.com")
+	w = ca.post("/admin/loginlockout/", "/admin/loginlockout/delete", url.Values{"id": {strconv.Itoa(l.Id)}})
+	is.Equal(302, w.Code)
+	is.Equal(302, login("bob@example.com", "secret"))
+
+	// not for users without role admin
+	other := LoginLockout{Kind: lockIp, Identity: "192.0.2.9", Failures: 1}
+	db.Create(&other)
+	w = c.do("GET", "/admin/loginlockout/", nil)
+	is.NotEqual(200, w.Code)
+	is.NotContains(w.Body.String(), "192.0.2.9")
+	c.post("/admin/", "/admin/loginlockout/delete", url.Values{"id": {strconv.Itoa(other.Id)}})
+	var n int64
+	db.Model(&LoginLockout{}).Where("identity = ?", "192.0.2.9").Count(&n)
+	is.Equal(int64(1), n)
+	c.post("/admin/", "/admin/logout", url.Values{})
+
+	// backoff, the next failure after expiration locks longer
+	is.Equal(401, login("bob", "wrong"))
+	is.Equal(401, login("bob", "wrong"))
+	is.Equal(401, login("bob", "wrong"))
+	db.Model(&LoginLockout{}).Where("kind = ?", lockAccount).Update("locked_until", time.Now())
+	is.Equal(401, login("bob", "wrong"))
+	var la LoginLockout
+	db.Where("kind = ? AND identity = ?", lockAccount, "bob@example.com").First(&la)
+	is.Equal(4, la.Failures)
+	is.WithinDuration(time.Now().Add(time.Hour), la.LockedUntil.Time, 5*time.Second)
+
+	// per ip, unknown accounts are counted too
+	var li LoginLockout
+	db.Where("kind = ? AND identity = ?", lockIp, "192.0.2.1").First(&li)
+	is.Equal(9, li.Failures)
+	is.Equal(429, login("nobody", "wrong"))
+	is.Equal(429, login("alice@example.com", "secret"))
+	is.Nil(admin.Security().Unlock(lockIp, "192.0.2.1"))
+	is.Equal(302, login("alice@example.com", "secret"))
+}
@@ -0,0 +1,107 @@
+package gadm
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mail struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string // text/plain
+}
+
+// RFC 5322 message
+func (m *Mail) Bytes() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// Send mail for registration, confirmation and password reset
+type Mailer interface {
+	Send(m *Mail) error
+}
+
+// Send with net/smtp, Addr like "smtp.example.com:587"
+type SmtpMailer struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+}
+
+func NewSmtpMailer(addr, username, password, from string) *SmtpMailer {
+	host, _, _ := strings.Cut(addr, ":")
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SmtpMailer{Addr: addr, Auth: auth, From: from}
+}
+
+func (M *SmtpMailer) Send(m *Mail) error {
+	m.From = emptyOr(m.From, M.From)
+	return smtp.SendMail(M.Addr, M.Auth, m.From, m.To, m.Bytes())
+}
+
+// Keep mails in memory, and write .eml files into Dir if not empty.
+// For development and tests.
+type Outbox struct {
+	Dir   string
+	From  string
+	mu    sync.Mutex
+	mails []*Mail
+}
+
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{Dir: dir, From: "admin@localhost"}
+}
+
+func (O *Outbox) Send(m *Mail) error {
+	m.From = emptyOr(m.From, O.From)
+
+	O.mu.Lock()
+	defer O.mu.Unlock()
+	O.mails = append(O.mails, m)
+
+	if O.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(O.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102-150405"), len(O.mails))
+	return os.WriteFile(filepath.Join(O.Dir, name), m.Bytes(), 0o644)
+}
+
+// All sent mails
+func (O *Outbox) Mails() []*Mail {
+	O.mu.Lock()
+	defer O.mu.Unlock()
+	return append([]*Mail{}, O.mails...)
+}
+
+// Last sent mail, nil if none
+func (O *Outbox) Last() *Mail {
+	O.mu.Lock()
+	defer O.mu.Unlock()
+	if len(O.mails) == 0 {
+		return nil
+	}
+	return O.mails[len(O.mails)-1]
+}
@@ -2,6 +2,7 @@ package gadm
 
 import (
 	"log"
+	"net/http"
 	"strings"
 
 	"github.com/samber/lo"
@@ -13,14 +14,17 @@ type Menu struct {
 	Name     string
 	Path     string
 
-	Icon  string
-	Class string
+	Icon   string
+	Class  string
+	Method string // POST renders a form with csrf token
 
 	IsActive     bool // TODO:
 	IsVisible    bool
 	IsAccessible bool
 
 	Children []*Menu
+
+	view View // menu of view
 }
 
 // TODO: AddCategory/AddLink/AddMenuItem
@@ -54,3 +58,29 @@ func (M *Menu) find(cate string) *Menu {
 	})
 	return c
 }
+
+// Copy of menu tree for current user, without invisible or inaccessible views
+func (M *Menu) visible(r *http.Request) *Menu {
+	m := *M
+	m.IsVisible, m.IsAccessible = true, true
+	if M.view != nil {
+		m.IsVisible = M.view.IsVisible(r)
+		m.IsAccessible = M.view.IsAccessible(r)
+		if !m.IsVisible || !m.IsAccessible {
+			return nil
+		}
+	}
+
+	m.Children = nil
+	for _, c := range M.Children {
+		if vc := c.visible(r); vc != nil {
+			m.Children = append(m.Children, vc)
+		}
+	}
+
+	// category without any child
+	if M.view == nil && M.Path == "" && len(M.Children) > 0 && len(m.Children) == 0 {
+		return nil
+	}
+	return &m
+}
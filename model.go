@@ -2,6 +2,7 @@ package gadm
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"log"
 	"reflect"
@@ -12,6 +13,7 @@ import (
 	"github.com/fatih/camelcase"
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
+	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
 )
 
@@ -40,6 +42,19 @@ func (r *Row) Set(field *Field, v any) {
 	r.Map[field.DBName] = v
 }
 
+// Value of column by db name, the changed one first
+func (r *Row) Get(name string) any {
+	if v, ok := r.Map[name]; ok {
+		return v
+	}
+	for _, f := range r.Fields {
+		if f.DBName == name {
+			return f.Value
+		}
+	}
+	return nil
+}
+
 // in detail/edit url is: id=pk1,pk2
 func (r *Row) GetPkValue() string {
 	vs := []string{}
@@ -51,6 +66,22 @@ func (r *Row) GetPkValue() string {
 	return strings.Join(vs, ",")
 }
 
+// Columns by db name in json, value of driver.Valuer like null.String is unwrapped
+func (r *Row) MarshalJSON() ([]byte, error) {
+	m := map[string]any{}
+	for _, f := range r.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		v := f.Value
+		if vr, ok := v.(driver.Valuer); ok && !isNil(v) {
+			v, _ = vr.Value()
+		}
+		m[f.DBName] = v
+	}
+	return json.Marshal(m)
+}
+
 func (r *Row) FieldOf(col *Field) *Field {
 	for _, f := range r.Fields {
 		if f.Field == col.Field {
@@ -114,18 +145,31 @@ func (m *Model) sortableColumns() []string { return m.schema.DBNames }
 // TODO: remove
 func (m *Model) get_pk_value(row *Row) string { return row.GetPkValue() }
 
+// rowid not matching the primary keys, no record is found by it
+var errMalformedId = fmt.Errorf("malformed id: %w", gorm.ErrRecordNotFound)
+
 // single primarykey, rowid: id
 // multiple primarykey, rowid like: pk1,pk2
-// return where condition map
-func (m *Model) where(rowid string) map[string]string {
+// return where condition map, error if the number of parts is wrong
+func (m *Model) where(rowid string) (map[string]string, error) {
 	vs := strings.Split(rowid, ",")
+	if len(m.schema.PrimaryFields) != len(vs) {
+		return nil, errMalformedId
+	}
 	res := map[string]string{}
-	if len(m.schema.PrimaryFields) == len(vs) {
-		for i := range vs {
-			res[m.schema.PrimaryFields[i].DBName] = vs[i]
-		}
+	for i := range vs {
+		res[m.schema.PrimaryFields[i].DBName] = vs[i]
 	}
-	return res
+	return res, nil
+}
+
+// Take record of rowid into ptr
+func (m *Model) take(tx *gorm.DB, rowid string, ptr any) error {
+	w, err := m.where(rowid)
+	if err != nil {
+		return err
+	}
+	return tx.Where(w).Take(ptr).Error
 }
 
 type Choice struct {
@@ -144,6 +188,16 @@ type Field struct {
 	Hidden      bool // for csrf token, TODO: remove, only in form
 	Value       any
 	Sortable    bool
+
+	// select2-ajax of lookup refer, name of the related table
+	Lookup   string
+	Multiple bool
+	// ids of current value, and [id, label] of them in json
+	LookupValue string
+	LookupJson  string
+
+	// of child in inline form, like addresses-0
+	Prefix string
 }
 
 func (f *Field) Endpoint() string {
@@ -155,6 +209,9 @@ func (f *Field) Endpoint() string {
 }
 
 func (f *Field) IsSlice() bool {
+	if f.DataType == schema.Bytes {
+		return false
+	}
 	rv := reflect.ValueOf(f.Value)
 	return rv.Kind() == reflect.Slice
 }
@@ -288,6 +345,10 @@ func indirect(a any) any {
 type Row struct {
 	Fields []*Field
 	Map    map[string]any
+	// submitted ids of has one and many to many, by field name
+	assocs map[string][]string
+	// submitted children of inline models
+	inlines []*inlineEntry
 }
 
 func NewRow(fs []*Field, a any) *Row {
@@ -296,14 +357,14 @@ func NewRow(fs []*Field, a any) *Row {
 	lo.ForEach(fs, func(f *Field, _ int) {
 		f.Value = fieldValue(a, f.Name)
 	})
-	return &Row{fs, map[string]any{}}
+	return &Row{Fields: fs, Map: map[string]any{}}
 }
 func NewSubRow(a any, fields []*Field) *Row {
 	fs := fields[:]
 	for _, f := range fs {
 		f.Value = fieldValue(a, f.Name)
 	}
-	return &Row{fs, map[string]any{}}
+	return &Row{Fields: fs, Map: map[string]any{}}
 }
 
 func clone(fs []*Field) []*Field {
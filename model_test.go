@@ -80,7 +80,11 @@ func TestModel(t *testing.T) {
 		// is.True(r1["is_normal"].(bool))
 
 		is.Equal("3", m.get_pk_value(r1))
-		is.Equal(map[string]string{"id": "3"}, m.where("3"))
+		w, err := m.where("3")
+		is.Nil(err)
+		is.Equal(map[string]string{"id": "3"}, w)
+		_, err = m.where("3,4")
+		is.ErrorIs(err, gorm.ErrRecordNotFound)
 	}
 
 	// protype
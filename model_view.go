@@ -1,7 +1,8 @@
 package gadm
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
@@ -9,8 +10,8 @@ import (
 	"net/url"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/fatih/camelcase"
 	"github.com/go-playground/form/v4"
@@ -33,6 +34,28 @@ type ModelView struct {
 	can_delete       bool
 	can_view_details bool
 	can_export       bool
+	can_api          bool
+	can_import       bool
+
+	// formats and columns of export
+	export_types       []string
+	column_export_list []string
+	export_batch_size  int
+
+	// open forms in modal window of list view
+	create_modal  bool
+	edit_modal    bool
+	details_modal bool
+
+	// roles required for each permission
+	permission_roles map[Permission][]string
+
+	// bulk actions besides delete
+	actions []*modelAction
+	// buttons on each row besides view, edit and delete
+	column_extra_row_actions []*RowAction
+
+	hooks modelHooks
 
 	// Customizations
 	column_list          []string
@@ -56,12 +79,19 @@ type ModelView struct {
 
 	lookupRefers map[string]*refer
 
+	inline_models []*inlineModel
+
 	// form
 	form_choices          map[string][]Choice
+	column_validators     map[string][]Validator
 	form_columns          []string
 	form_excluded_columns []string
 
 	filters []Filter
+	// custom filters, see AddFilters
+	extra_filters []Filter
+	// condition of rows the request can see, nil for all
+	row_scope func(r *http.Request) clause.Expression
 
 	// <textarea row=5>
 	textareaRow map[string]int
@@ -75,6 +105,8 @@ type ModelView struct {
 	fsList []*Field
 	fsNew  []*Field
 	fsEdit []*Field
+	// export columns
+	fsExport []*Field
 
 	gt *groupTempl
 }
@@ -100,6 +132,9 @@ func NewModelView(m any, db *gorm.DB, category ...string) *ModelView {
 		can_delete:             true,
 		can_view_details:       true,
 		can_export:             true, // false
+		export_types:           exportTypes,
+		export_batch_size:      1000,
+		permission_roles:       map[Permission][]string{PermShare: {"admin"}},
 		page_size:              20,
 		can_set_page_size:      false,
 		column_display_actions: true,
@@ -113,20 +148,28 @@ func NewModelView(m any, db *gorm.DB, category ...string) *ModelView {
 		Path:     "/" + model.endpoint(),
 		Children: map[string]*Blueprint{
 			// In flask-admin use `view.index`. Should use `view.index_view` in `gadmin`
-			"index":        {Endpoint: "index", Path: "/", Handler: mv.indexHandler},
-			"index_view":   {Endpoint: "index_view", Path: "/", Handler: mv.indexHandler},
-			"create_view":  {Endpoint: "create_view", Path: "/new", Handler: mv.newHandler},
-			"details_view": {Endpoint: "details_view", Path: "/details", Handler: mv.detailHandler},
-			"ajax_update":  {Endpoint: "ajax_update", Path: "/ajax/update", Handler: mv.ajaxUpdate},
-			"ajax_lookup":  {Endpoint: "ajax_lookup", Path: "/ajax/lookup", Handler: mv.ajaxLookup},
-			"action_view":  {Endpoint: "action_view", Path: "/action", Handler: mv.actionHandler},
-			"edit_view":    {Endpoint: "edit_view", Path: "/edit", Handler: mv.editHandler},
-			"delete_view":  {Endpoint: "delete_view", Path: "/delete", Handler: mv.deleteHandler},
+			"index":           {Endpoint: "index", Path: "/", Handler: mv.indexHandler},
+			"index_view":      {Endpoint: "index_view", Path: "/", Handler: mv.indexHandler},
+			"create_view":     {Endpoint: "create_view", Path: "/new", Handler: mv.newHandler},
+			"details_view":    {Endpoint: "details_view", Path: "/details", Handler: mv.detailHandler},
+			"history_view":    {Endpoint: "history_view", Path: "/history", Handler: mv.historyHandler},
+			"ajax_update":     {Endpoint: "ajax_update", Path: "/ajax/update", Handler: mv.ajaxUpdate},
+			"ajax_lookup":     {Endpoint: "ajax_lookup", Path: "/ajax/lookup", Handler: mv.ajaxLookup},
+			"action_view":     {Endpoint: "action_view", Path: "/action", Handler: mv.actionHandler},
+			"row_action_view": {Endpoint: "row_action_view", Path: "/row_action", Handler: mv.rowActionHandler},
+			"edit_view":       {Endpoint: "edit_view", Path: "/edit", Handler: mv.editHandler},
+			"delete_view":     {Endpoint: "delete_view", Path: "/delete", Handler: mv.deleteHandler},
 			// not .export_view
-			"export": {Endpoint: "export", Path: "/export", Handler: mv.exportHandler},
-			"debug":  {Endpoint: "debug", Path: "/debug", Handler: mv.debugHandler},
+			"export":        {Endpoint: "export", Path: "/export", Handler: mv.exportHandler},
+			"import_view":   {Endpoint: "import_view", Path: "/import", Handler: mv.importHandler},
+			"import_report": {Endpoint: "import_report", Path: "/import/report", Handler: mv.importReportHandler},
+			"saved_view":    {Endpoint: "saved_view", Path: "/saved_view", Handler: mv.savedViewHandler},
+			"debug":         {Endpoint: "debug", Path: "/debug", Handler: mv.debugHandler},
 			// for json
 			"list": {Endpoint: "list", Path: "/list", Handler: mv.listJson},
+			// rest api, see SetApi
+			"api":     {Endpoint: "api", Path: "/api", Handler: mv.apiHandler},
+			"api_one": {Endpoint: "api_one", Path: "/api/{id}", Handler: mv.apiHandler},
 		},
 	}
 
@@ -158,7 +201,129 @@ func (V *ModelView) Preloads(query string, args ...any) *ModelView {
 	return V
 }
 
-// Permissions
+// Permissions of model view, each can require roles of current user
+type Permission string
+
+const (
+	PermList   Permission = "list"
+	PermCreate Permission = "create"
+	PermEdit   Permission = "edit"
+	PermDelete Permission = "delete"
+	PermExport Permission = "export"
+	PermImport Permission = "import"
+	// share saved views with everyone, requires role admin by default
+	PermShare Permission = "share"
+)
+
+var builtinPermissions = []Permission{PermList, PermCreate, PermEdit, PermDelete, PermExport, PermImport, PermShare}
+
+// Name of action is checked as permission, so it can not be a built-in one
+func checkActionName(name string) {
+	if name == "" || lo.Contains(builtinPermissions, Permission(name)) {
+		panic(fmt.Sprintf("action name %q is reserved", name))
+	}
+}
+
+// Current user should have one of roles for the permission.
+// Other permissions require PermList roles too.
+func (V *ModelView) SetRequiredRoles(perm Permission, roles ...string) *ModelView {
+	if V.permission_roles == nil {
+		V.permission_roles = map[Permission][]string{}
+	}
+	V.permission_roles[perm] = roles
+	return V
+}
+
+// Only users with one of roles can access the view, chainable
+func (V *ModelView) SetAccessRoles(roles ...string) *ModelView {
+	V.BaseView.SetAccessRoles(roles...)
+	return V
+}
+
+// Bulk action on selected rows of list view
+type modelAction struct {
+	name         string
+	title        string
+	confirmation string
+	handler      func(ctx context.Context, ids []string) error
+}
+
+// Add bulk action to the "With selected" dropdown of list view.
+// Permission(name) is required, use SetRequiredRoles(Permission(name), ...) to restrict it.
+// Panics if name is a built-in permission like "delete".
+func (V *ModelView) AddAction(name, title, confirmation string, handler func(ctx context.Context, ids []string) error) *ModelView {
+	checkActionName(name)
+	V.actions = append(V.actions, &modelAction{name, title, confirmation, handler})
+	return V
+}
+
+func (V *ModelView) action(name string) *modelAction {
+	for _, a := range V.actions {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Button on each row of list view
+type RowAction struct {
+	Name  string
+	Title string
+	// css class, like "fa fa-envelope"
+	Icon         string
+	Confirmation string
+	// link built from primary key of the row
+	URL func(pk string) string
+	// POST to row_action_view when URL is nil
+	Handler func(ctx context.Context, pk string) error
+}
+
+// Add button next to view, edit and delete in list view.
+// Permission(a.Name) is required, like AddAction.
+func (V *ModelView) AddRowAction(a RowAction) *ModelView {
+	checkActionName(a.Name)
+	V.column_extra_row_actions = append(V.column_extra_row_actions, &a)
+	return V
+}
+
+func (V *ModelView) row_action(name string) *RowAction {
+	for _, a := range V.column_extra_row_actions {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Is permission allowed for current user
+func (V *ModelView) can(r *http.Request, perm Permission) bool {
+	enabled := map[Permission]bool{
+		PermList:   true,
+		PermCreate: V.can_create,
+		PermEdit:   V.can_edit,
+		PermDelete: V.can_delete,
+		PermExport: V.can_export,
+		PermImport: V.can_import,
+		PermShare:  true,
+	}
+	if _, ok := enabled[perm]; !ok {
+		enabled[perm] = V.action(string(perm)) != nil || V.row_action(string(perm)) != nil
+	}
+	if !enabled[perm] || !V.BaseView.IsAccessible(r) {
+		return false
+	}
+	if t := apiTokenOf(r); t != nil && !t.allows(perm) {
+		return false
+	}
+
+	security := V.admin.security
+	return security.HasRole(r, V.permission_roles[PermList]...) &&
+		security.HasRole(r, V.permission_roles[perm]...)
+}
+
+func (V *ModelView) IsAccessible(r *http.Request) bool { return V.can(r, PermList) }
+
 // Is model creation allowed
 func (V *ModelView) SetCanCreate(v bool) *ModelView {
 	V.can_create = v
@@ -170,11 +335,39 @@ func (V *ModelView) SetCanEdit(v bool) *ModelView {
 	V.can_edit = v
 	return V
 }
+
+// Is model deletion allowed
+func (V *ModelView) SetCanDelete(v bool) *ModelView {
+	V.can_delete = v
+	return V
+}
+
 func (V *ModelView) SetCanExport(v bool) *ModelView {
 	V.can_export = v
 	return V
 }
 
+// Open create form in modal window of list view
+func (V *ModelView) SetCreateModal(v bool) *ModelView {
+	V.create_modal = v
+	return V
+}
+
+// Open edit form in modal window of list view
+func (V *ModelView) SetEditModal(v bool) *ModelView {
+	V.edit_modal = v
+	return V
+}
+
+// Open details in modal window of list view
+func (V *ModelView) SetDetailsModal(v bool) *ModelView {
+	V.details_modal = v
+	return V
+}
+
+// Requested as fragment for modal window: ?modal=1
+func isModal(r *http.Request) bool { return r.URL.Query().Get("modal") != "" }
+
 // Collection of the model field names for the list view.
 // If not set, will get them from the model.
 func (V *ModelView) SetColumnList(vs ...string) *ModelView {
@@ -248,24 +441,9 @@ func astoss(as []any) string {
 // refer.fields like query
 // Return slice of [id, "f1, f2"]
 func (rf *refer) Lookup(db *gorm.DB, query string, offset, limit int) [][]any {
-	ndb := db.Limit(limit).Offset(offset)
-
-	pks := []string{}
-	fns := lo.Map(lo.Filter(rf.model.Fields, func(f *Field, _ int) bool {
-		if f.PrimaryKey {
-			pks = append(pks, f.DBName)
-			return true
-		}
-		if slices.Contains(rf.fields, f.DBName) {
-			return true
-		}
-		return false
-	}), func(f *Field, _ int) string {
-		return f.DBName
-	})
-
-	ndb = ndb.Table(rf.model.schema.Table).
-		Select(fns)
+	ndb := db.Limit(limit).Offset(offset).
+		Table(rf.model.schema.Table).
+		Select(rf.columns())
 
 	for i, f := range rf.fields {
 		if i == 0 {
@@ -276,28 +454,45 @@ func (rf *refer) Lookup(db *gorm.DB, query string, offset, limit int) [][]any {
 	}
 	var ms []map[string]any
 	if tx := ndb.Find(&ms); tx.Error == nil {
-		return lo.Map(ms, func(m map[string]any, _ int) []any {
-			var id any
-			ids := []any{}
-			for _, pk := range pks {
-				ids = append(ids, m[pk])
-			}
-			if len(ids) > 1 {
-				id = astoss(ids)
-			} else {
-				id = ids[0]
-			}
-
-			vs := []any{}
-			for _, f := range rf.fields {
-				vs = append(vs, m[f])
-			}
-			return []any{id, astoss(vs)}
-		})
+		return rf.rows(ms)
 	}
 	return [][]any{}
 }
 
+// primary keys and refer.fields
+func (rf *refer) columns() []string {
+	return lo.Map(lo.Filter(rf.model.Fields, func(f *Field, _ int) bool {
+		return f.PrimaryKey || slices.Contains(rf.fields, f.DBName)
+	}), func(f *Field, _ int) string {
+		return f.DBName
+	})
+}
+
+// [id, "f1, f2"], id as label without fields
+func (rf *refer) rows(ms []map[string]any) [][]any {
+	return lo.Map(ms, func(m map[string]any, _ int) []any {
+		var id any
+		ids := []any{}
+		for _, f := range rf.model.schema.PrimaryFields {
+			ids = append(ids, m[f.DBName])
+		}
+		if len(ids) > 1 {
+			id = astoss(ids)
+		} else {
+			id = ids[0]
+		}
+
+		vs := []any{}
+		for _, f := range rf.fields {
+			vs = append(vs, m[f])
+		}
+		if len(vs) == 0 {
+			return []any{id, cast.ToString(id)}
+		}
+		return []any{id, astoss(vs)}
+	})
+}
+
 // user: [first_name, last_name]
 // lookup table user's first_name, last_name
 func (V *ModelView) AddLookupRefer(a any, fields ...string) *ModelView {
@@ -329,6 +524,7 @@ func (V *ModelView) transform(fs []*schema.Field) []*Field {
 
 func (V *ModelView) freeze() {
 	fs := V.transform(V.schema.Fields)
+	V.setupRelations(fs)
 
 	V.fsList = lo.Filter(fs, func(field *Field, _ int) bool {
 		// exclude return false
@@ -356,9 +552,10 @@ func (V *ModelView) freeze() {
 		}
 	}
 
-	V.fsNew = lo.Filter(fs, func(f *Field, _ int) bool {
+	// need clone: create form is not read only of can_edit
+	V.fsNew = clone(lo.Filter(fs, func(f *Field, _ int) bool {
 		// exclude, return false
-		if slices.Contains(V.form_excluded_columns, f.DBName) {
+		if slices.Contains(V.form_excluded_columns, f.DBName) || !V.inForm(f) {
 			return false
 		}
 		// include, return true
@@ -366,12 +563,15 @@ func (V *ModelView) freeze() {
 			return true
 		}
 		return !f.PrimaryKey
-	})
+	}))
+	for _, f := range V.fsNew {
+		f.Readonly = false
+	}
 
 	// need clone: change Readonly
 	V.fsEdit = clone(lo.Filter(fs, func(f *Field, _ int) bool {
 		// exclude, return false
-		if slices.Contains(V.form_excluded_columns, f.DBName) {
+		if slices.Contains(V.form_excluded_columns, f.DBName) || !V.inForm(f) {
 			return false
 		}
 		// include, return true
@@ -392,84 +592,34 @@ func (V *ModelView) freeze() {
 			f.Readonly = true
 		}
 	}
+	V.fsExport = V.exportFields(fs)
 
 	V.filters = []Filter{}
 	for _, name := range V.column_filters {
 		if f, ok := lo.Find(fs, func(f *Field) bool {
 			return f.DBName == name
 		}); ok {
-			V.filters = append(V.filters, V.filtersOf(f)...)
-		}
-	}
-	for i := 0; i < len(V.filters); i++ {
-		V.filters[i].Index = i
-		V.filters[i].Arg = cast.ToString(i)
-	}
-}
-func (V *ModelView) filtersOf(f *Field) []Filter {
-	switch f.DataType {
-	case schema.Bool:
-		return []Filter{
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "equal", Options: [][]string{{"1", "Yes"}, {"0", "No"}}},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not equal", Options: [][]string{{"1", "Yes"}, {"0", "No"}}},
-		}
-	case schema.Int:
-		return []Filter{
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "equal"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not equal"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "greater"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "smaller"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "empty", Options: [][]string{{"1", "Yes"}, {"0", "No"}}},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "in list", WidgetType: ptr("select2-tags")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not in list", WidgetType: ptr("select2-tags")},
-		}
-	case schema.String:
-		return []Filter{
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "like"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not like"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "equal"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not equal"},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "empty", Options: [][]string{{"1", "Yes"}, {"0", "No"}}},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "in list", WidgetType: ptr("select2-tags")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not in list", WidgetType: ptr("select2-tags")},
+			V.filters = append(V.filters, ColumnFilters(f.Label, f.DBName, f.DataType)...)
 		}
-	case schema.Time:
-		return []Filter{
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "equal", WidgetType: ptr("datetimepicker")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not equal", WidgetType: ptr("datetimepicker")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "greater", WidgetType: ptr("datetimepicker")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "smaller", WidgetType: ptr("datetimepicker")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "between", WidgetType: ptr("datetimerangepicker")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "not between", WidgetType: ptr("datetimerangepicker")},
-			{Field: f, Label: f.Label, DBName: f.DBName, Operation: "empty", Options: [][]string{{"1", "Yes"}, {"0", "No"}}},
-		}
-	}
-	return nil
-}
-
-func toGroup(fs []Filter) map[string][]Filter {
-	g := map[string][]Filter{}
-	for _, f := range fs {
-		g[f.Label] = append(g[f.Label], f)
 	}
-	return g
+	V.filters = append(V.filters, V.extra_filters...)
 }
-
 func (V *ModelView) dict(r *http.Request, others ...map[string]any) map[string]any {
 	o := V.BaseView.dict(r, map[string]any{
 		"table_prefix_html": V.table_prefix_html,
 		"editable_columns":  true,
-		"can_create":        V.can_create,
-		"can_edit":          V.can_edit,
-		"can_export":        V.can_export,
+		"can_create":        V.can(r, PermCreate),
+		"can_edit":          V.can(r, PermEdit),
+		"can_export":        V.can(r, PermExport),
+		"can_import":        V.can(r, PermImport),
 		"can_view_details":  V.can_view_details,
-		"can_delete":        V.can_delete,
-		"export_types":      []string{"csv", "xls"},
-		// TODO: modal for edit/create/details
-		"edit_modal":    false,
-		"create_modal":  false,
-		"details_modal": false,
-		"is_modal":      false,
+		"can_view_history":  V.can_view_details && V.admin != nil && V.admin.Audit().Enabled(),
+		"can_delete":        V.can(r, PermDelete),
+		"export_types":      V.export_types,
+		"edit_modal":        V.edit_modal,
+		"create_modal":      V.create_modal,
+		"details_modal":     V.details_modal,
+		"is_modal":          isModal(r),
 		"form_opts": map[string]any{
 			"widget_args": nil,
 			"form_rules":  []any{},
@@ -492,6 +642,9 @@ func (V *ModelView) queryFrom(r *http.Request) *Query {
 	uv := r.Form
 
 	form.NewDecoder().Decode(&q, uv)
+	if V.row_scope != nil {
+		q.scope = V.row_scope(r)
+	}
 	for k, v := range uv {
 		if lo.IndexOf([]string{"page", "page_size", "sort", "desc", "search"}, k) != -1 {
 			continue
@@ -513,9 +666,10 @@ func (V *ModelView) inputFilter(k, v string) *InputFilter {
 	arr := lo.Map(strings.Split(k[2:], "_"), func(s string, _ int) int {
 		return cast.ToInt(s)
 	})
-	if arr[1] < len(V.filters) {
+	// like flt0_3, ignore malformed or out of range
+	if len(arr) == 2 && arr[1] >= 0 && arr[1] < len(V.filters) {
 		f := V.filters[arr[1]]
-		return &InputFilter{Label: f.Label, Index: arr[1], Query: v}
+		return &InputFilter{Label: f.Label(), Index: arr[1], Query: v}
 	}
 	return nil
 }
@@ -530,14 +684,14 @@ func (V *ModelView) get_column_index(name string) int {
 }
 
 func (V *ModelView) column_name(i int) string {
-	if i < len(V.fsList) {
+	if i >= 0 && i < len(V.fsList) {
 		return V.fsList[i].DBName
 	}
 	return ""
 }
 
-func (V *ModelView) is_editable(name string) bool {
-	if !V.can_edit {
+func (V *ModelView) is_editable(r *http.Request, name string) bool {
+	if !V.can(r, PermEdit) {
 		return false
 	}
 	_, ok := lo.Find(V.column_editable_list, func(i string) bool {
@@ -554,13 +708,13 @@ func (V *ModelView) list_row_actions(r *http.Request) []Action {
 			Title: gettext("View Record"),
 		})
 	}
-	if V.can_edit {
+	if V.can(r, PermEdit) {
 		actions = append(actions, Action{
 			Name:  "edit",
 			Title: gettext("Edit Record"),
 		})
 	}
-	if V.can_delete {
+	if V.can(r, PermDelete) {
 		actions = append(actions, Action{
 			Name:         "delete",
 			Title:        gettext("Delete Record"),
@@ -571,6 +725,43 @@ func (V *ModelView) list_row_actions(r *http.Request) []Action {
 	return actions
 }
 
+func (V *ModelView) list_extra_row_actions(r *http.Request) []*RowAction {
+	return lo.Filter(V.column_extra_row_actions, func(a *RowAction, _ int) bool {
+		return V.can(r, Permission(a.Name))
+	})
+}
+
+// actions for selected rows in list view
+func (V *ModelView) list_actions(r *http.Request) []Action {
+	as := []Action{}
+	if V.can(r, PermDelete) {
+		as = append(as, Action{Name: "delete", Title: gettext("Delete"),
+			Confirmation: gettext("Are you sure you want to delete selected records?")})
+	}
+	for _, a := range V.actions {
+		if V.can(r, Permission(a.name)) {
+			as = append(as, Action{Name: a.name, Title: a.title, Confirmation: a.confirmation})
+		}
+	}
+	for i := range as {
+		as[i].CSRFToken = csrf.Token(r)
+		as[i].URL = must(V.Blueprint.GetUrl(".action_view"))
+		as[i].ReturnURL = must(V.Blueprint.GetUrl(".index_view"))
+	}
+	return as
+}
+
+// name => confirmation, for actions.js
+func actionsConfirmation(as []Action) map[string]string {
+	m := map[string]string{}
+	for _, a := range as {
+		if a.Confirmation != "" {
+			m[a.Name] = a.Confirmation
+		}
+	}
+	return m
+}
+
 func (V *ModelView) debugHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Query().Get("a") == "1" {
 		V.AddFlash(r, FlashSuccess(`Record was successfully deleted.
@@ -587,10 +778,17 @@ func (V *ModelView) debugHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 func (V *ModelView) indexHandler(w http.ResponseWriter, r *http.Request) {
+	views := V.savedViews(r)
+	// open default view without query, ?all=1 for all
+	if sv, ok := lo.Find(views, func(sv SavedView) bool { return sv.IsDefault }); ok && r.URL.RawQuery == "" {
+		V.redirect(w, r, V.savedViewUrl(&sv))
+		return
+	}
 	q := V.queryFrom(r)
 
 	result := V.list(q)
 	result.Fields = V.fsList
+	actions := V.list_actions(r)
 
 	V.Render(w, r, "model_list.gotmpl", template.FuncMap{
 		"is_sortable": func(name string) bool {
@@ -626,15 +824,12 @@ func (V *ModelView) indexHandler(w http.ResponseWriter, r *http.Request) {
 		"get_pk_value":             V.get_pk_value,
 		"column_display_pk":        V.column_display_pk,
 		"column_display_actions":   V.column_display_actions,
-		"column_extra_row_actions": nil,
+		"column_extra_row_actions": V.list_extra_row_actions(r),
 		"list_row_actions":         V.list_row_actions(r),
-		"actions": []Action{{Name: "delete", Title: "Delete",
-			CSRFToken: csrf.Token(r),
-			URL:       must(V.Blueprint.GetUrl(".action_view")),
-			ReturnURL: must(V.Blueprint.GetUrl(".index_view"))}},
-		"actions_confirmation": map[string]string{"delete": "Are you sure you want to delete selected records?"},
-		"list_columns":         V.fsList,
-		"sort":                 q.Sort,
+		"actions":                  actions,
+		"actions_confirmation":     actionsConfirmation(actions),
+		"list_columns":             V.fsList,
+		"sort":                     q.Sort,
 		// not func, return current sort field name
 		// in template, `sort url` is: ?sort={index}
 		// transform `index` to `column name`
@@ -650,9 +845,13 @@ func (V *ModelView) indexHandler(w http.ResponseWriter, r *http.Request) {
 		"column_searchable_list": V.column_searchable_list,
 		"search_placeholder":     strings.Join(V.column_searchable_list, ","),
 
-		"filters":        len(V.column_filters) > 0,
+		"filters":        len(V.filters) > 0,
 		"filter_groups":  toGroup(V.filters),
 		"active_filters": activeFilter(q.filters), // [[27, "Title", "part"]]
+		"saved_views":    V.savedViewLinks(r, views),
+		"can_save_view":  V.admin.security.CurrentUser(r) != nil && V.admin.security.Enabled(),
+		"view_query":     viewQuery(r.Form),
+		"can_share":      V.can(r, PermShare),
 		"clear_search_url": func() string {
 			qc := *q
 			qc.Search = ""
@@ -660,6 +859,8 @@ func (V *ModelView) indexHandler(w http.ResponseWriter, r *http.Request) {
 		}(),
 	})
 }
+
+// Rows of list in json, columns by db name like the REST API
 func (V *ModelView) listJson(w http.ResponseWriter, r *http.Request) {
 	q := V.queryFrom(r)
 
@@ -674,41 +875,55 @@ func (V *ModelView) listJson(w http.ResponseWriter, r *http.Request) {
 
 func (V *ModelView) newHandler(w http.ResponseWriter, r *http.Request) {
 	q := V.queryFrom(r)
-	if !V.can_create {
+	if !V.can(r, PermCreate) {
 		V.redirect(w, r, q.Get("url"))
 		return
 	}
 
+	form := NewForm(V.fsNew, nil, csrf.Token(r))
 	if r.Method == http.MethodPost {
 		// trigger ParseMultipartForm
 		continue_editing := r.PostFormValue("_continue_editing")
 
-		one := V.intoRow(r.PostForm, V.fsNew)
-		err := V.create(one)
-		if err != nil {
-			V.AddFlash(r, FlashError(err))
-		} else {
-			V.AddFlash(r, FlashInfo(gettext("Record was successfully created.")))
-		}
-
-		if continue_editing != "" {
-			rowid := one.GetPkValue()
-			V.redirect(w, r, must(V.Blueprint.GetUrl(".edit_view", "id", rowid)))
-			return
-		}
-		if r.PostFormValue("_add_another") != "" {
-			V.redirect(w, r, must(V.Blueprint.GetUrl(".create_view")))
-			return
+		form.Row = submitted(NewRow(V.fsNew, V.new()), r.PostForm)
+		form.Errors = V.validate(r.PostForm, V.fsNew, true)
+		if len(form.Errors) == 0 {
+			one := V.intoRow(r.PostForm, V.fsNew)
+			if err := V.create(r.Context(), one); err != nil {
+				V.AddFlash(r, Flash(gettext("Failed to create record. %s", err), "error"))
+			} else {
+				V.AddFlash(r, FlashInfo(gettext("Record was successfully created.")))
+
+				if isModal(r) {
+					// list is refreshed by modal_form.js
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				if continue_editing != "" {
+					rowid := one.GetPkValue()
+					V.redirect(w, r, must(V.Blueprint.GetUrl(".edit_view", "id", rowid)))
+					return
+				}
+				if r.PostFormValue("_add_another") != "" {
+					V.redirect(w, r, must(V.Blueprint.GetUrl(".create_view")))
+					return
+				}
+
+				V.redirect(w, r, q.Get("url"))
+				return
+			}
 		}
-
-		V.redirect(w, r, q.Get("url"))
-		return
 	}
 
-	// GET
-	V.Render(w, r, "model_create.gotmpl", nil, map[string]any{
+	V.fillLookups(r.Context(), form.Row)
+	form.Inlines = V.inlineForms(r.Context(), "", r.PostForm, form.Errors)
+	fn := "model_create.gotmpl"
+	if isModal(r) {
+		fn = "model_modal_create.gotmpl"
+	}
+	V.Render(w, r, fn, nil, map[string]any{
 		"request":    rd(r),
-		"form":       NewForm(V.fsNew, nil, csrf.Token(r)),
+		"form":       form,
 		"cancel_url": must(V.Blueprint.GetUrl(".index_view")),
 		"form_opts": map[string]any{
 			"widget_args": nil, "form_rules": nil,
@@ -732,28 +947,41 @@ func (V *ModelView) editHandler(w http.ResponseWriter, r *http.Request) {
 	q := V.queryFrom(r)
 	rowid := q.Get("id")
 
-	if !V.can_edit || rowid == "" {
+	if !V.can(r, PermEdit) || rowid == "" {
 		V.redirect(w, r, q.Get("url"))
 		return
 	}
 
-	row, err := V.getOne(rowid)
+	row, err := V.getRow(rowid, V.fsEdit)
 	if err != nil {
 		V.AddFlash(r, FlashInfo(gettext("Record does not exist.")))
 		V.redirect(w, r, q.Get("url"))
 		return
 	}
+	form := NewForm(V.fsEdit, row, csrf.Token(r))
+	// submitted, to render again
+	var posted url.Values
 	if r.Method == http.MethodPost {
-		one := V.intoRow(r.PostForm, V.fsEdit)
-		if V.update(rowid, one) != nil {
-			V.AddFlash(r, FlashDanger(gettext("Record does not exist.")))
-		}
-
-		if r.PostFormValue("_add_another") != "" {
+		form.Errors = V.validate(r.PostForm, V.fsEdit, false)
+		if len(form.Errors) > 0 {
+			form.Row = submitted(row, r.PostForm)
+			posted = r.PostForm
+		} else if err := V.update(r.Context(), rowid, V.intoRow(r.PostForm, V.fsEdit)); err != nil {
+			V.AddFlash(r, Flash(gettext("Failed to update record. %s", err), "error"))
+			form.Row = submitted(row, r.PostForm)
+			posted = r.PostForm
+		} else if isModal(r) {
+			V.AddFlash(r, FlashInfo(gettext("Record was successfully saved.")))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		} else if r.PostFormValue("_add_another") != "" {
 			V.redirect(w, r, must(V.Blueprint.GetUrl(".create_view")))
 			return
 		} else if r.PostFormValue("_continue_editing") != "" {
-			// do nothing next Render
+			// render the saved record
+			if row, err = V.getRow(rowid, V.fsEdit); err == nil {
+				form.Row = row
+			}
 		} else {
 			// Save only, redirect to url
 			V.redirect(w, r)
@@ -761,9 +989,15 @@ func (V *ModelView) editHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	V.Render(w, r, "model_edit.gotmpl", nil, map[string]any{
+	V.fillLookups(r.Context(), form.Row)
+	form.Inlines = V.inlineForms(r.Context(), rowid, posted, form.Errors)
+	fn := "model_edit.gotmpl"
+	if isModal(r) {
+		fn = "model_modal_edit.gotmpl"
+	}
+	V.Render(w, r, fn, nil, map[string]any{
 		"row":     row,
-		"form":    NewForm(V.fsEdit, row, csrf.Token(r)),
+		"form":    form,
 		"request": rd(r),
 	})
 }
@@ -772,12 +1006,12 @@ func (V *ModelView) editHandler(w http.ResponseWriter, r *http.Request) {
 func (V *ModelView) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	q := V.queryFrom(r)
 	rowid := q.Get("id")
-	if !V.can_delete || rowid == "" {
+	if !V.can(r, PermDelete) || rowid == "" {
 		V.redirect(w, r)
 		return
 	}
 
-	err := V.deleteOne(rowid)
+	err := V.deleteOne(r.Context(), rowid)
 	if err != nil {
 		V.AddFlash(r, Flash(gettext("Failed to delete record. %s", err), "error"))
 	} else {
@@ -787,6 +1021,35 @@ func (V *ModelView) deleteHandler(w http.ResponseWriter, r *http.Request) {
 	V.redirect(w, r)
 }
 
+// POST name=row action&id=pk
+func (V *ModelView) rowActionHandler(w http.ResponseWriter, r *http.Request) {
+	q := V.queryFrom(r)
+	rowid := q.Get("id")
+	a := V.row_action(q.Get("name"))
+	if r.Method != http.MethodPost || a == nil || a.Handler == nil ||
+		!V.can(r, Permission(a.Name)) || rowid == "" {
+		V.redirect(w, r)
+		return
+	}
+
+	err := V.transaction(r.Context(), func(ctx context.Context, tx *gorm.DB) error {
+		ids, err := V.existing(tx, []string{rowid})
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return errors.New(gettext("Record does not exist."))
+		}
+		return a.Handler(ctx, ids[0])
+	})
+	if err != nil {
+		V.AddFlash(r, FlashError(err))
+	} else {
+		V.AddFlash(r, FlashSuccess(gettext("%s: record was processed.", a.Title)))
+	}
+	V.redirect(w, r)
+}
+
 // Model().Where(pk field = pk value).First()
 func (V *ModelView) detailHandler(w http.ResponseWriter, r *http.Request) {
 	q := V.queryFrom(r)
@@ -797,7 +1060,7 @@ func (V *ModelView) detailHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	row, err := V.getOne(rowid)
+	row, err := V.getOne(r, rowid)
 	if err != nil {
 		V.AddFlash(r, FlashDanger(gettext("Record does not exist.")))
 
@@ -805,7 +1068,11 @@ func (V *ModelView) detailHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	V.Render(w, r, "model_details.gotmpl", nil, map[string]any{
+	fn := "model_details.gotmpl"
+	if isModal(r) {
+		fn = "model_modal_details.gotmpl"
+	}
+	V.Render(w, r, fn, nil, map[string]any{
 		"row":             row,
 		"details_columns": V.Fields, // show all fields
 		"request":         rd(r),
@@ -826,16 +1093,24 @@ func (V *ModelView) ajaxUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !V.can(r, PermEdit) {
+		w.WriteHeader(403)
+		return
+	}
+
 	// form
 	r.ParseForm()
 	rowid := r.Form.Get("list_form_pk")
 
+	if errs := V.validate(r.Form, V.fsEdit, false); len(errs) > 0 {
+		w.WriteHeader(400)
+		w.Write([]byte(errs.String()))
+		return
+	}
 	row := V.intoRow(r.Form, V.fsEdit)
 
-	// TODO: validate
-
 	// update_model
-	if err := V.update(rowid, row); err != nil {
+	if err := V.update(r.Context(), rowid, row); err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(V.admin.gettext("Failed to update record. %s", err)))
 		return
@@ -861,49 +1136,34 @@ func (V *ModelView) ajaxLookup(w http.ResponseWriter, r *http.Request) {
 func (V *ModelView) actionHandler(w http.ResponseWriter, r *http.Request) {
 	action := r.FormValue("action")
 	rowid := r.Form["rowid"]
-	if !V.can_delete || len(rowid) == 0 {
+	if !V.can(r, Permission(action)) || len(rowid) == 0 {
 		V.redirect(w, r)
 		return
 	}
 
 	if action == "delete" {
-		tx := V.deleteBatch(rowid)
-		if tx.Error == nil {
-			V.AddFlash(r, FlashSuccess(fmt.Sprintf("delete %d success", tx.RowsAffected)))
+		n, err := V.deleteBatch(r.Context(), rowid)
+		if err == nil {
+			V.AddFlash(r, FlashSuccess(gettext("%d records were successfully deleted.", n)))
 		} else {
-			V.AddFlash(r, FlashError(tx.Error))
+			V.AddFlash(r, Flash(gettext("Failed to delete records. %s", err), "error"))
 		}
-	}
-	V.redirect(w, r)
-}
-func (V *ModelView) exportHandler(w http.ResponseWriter, r *http.Request) {
-	q := V.queryFrom(r)
-	result := V.list(q)
-	if result.Error != nil {
-		panic(result.Error)
-	}
-
-	fn := fmt.Sprintf("attachment;filename=%s-%s.csv", V.name(),
-		time.Now().Format(time.DateOnly))
-	w.Header().Add("content-disposition", fn)
-	w.Header().Add("content-type", "text/csv")
-
-	cw := csv.NewWriter(w)
-
-	// header
-	header := lo.Map(result.Fields, func(f *Field, _ int) string {
-		return f.DBName
-	})
-	cw.Write(header)
-
-	for _, row := range result.Rows {
-		line := lo.Map(row.Fields, func(f *Field, _ int) string {
-			return f.Display()
+	} else if a := V.action(action); a != nil {
+		var n int
+		err := V.transaction(r.Context(), func(ctx context.Context, tx *gorm.DB) error {
+			ids, err := V.existing(tx, rowid)
+			if n = len(ids); err != nil || n == 0 {
+				return err
+			}
+			return a.handler(ctx, ids)
 		})
-		cw.Write(line)
+		if err != nil {
+			V.AddFlash(r, FlashError(err))
+		} else {
+			V.AddFlash(r, FlashSuccess(gettext("%s: %d records were processed.", a.title, n)))
+		}
 	}
-
-	cw.Flush()
+	V.redirect(w, r)
 }
 
 // request to dict, like flask.request
@@ -943,7 +1203,12 @@ func (V *ModelView) Render(w http.ResponseWriter, r *http.Request, name string,
 		"csrf_token":  func() string { return csrf.Token(r) },
 		"list_form":   V.inline_form(csrf.Token(r)),
 		"delete_form": V.delete_form,
-		"is_editable": V.is_editable,
+		"is_editable": func(name string) bool { return V.is_editable(r, name) },
+		"tags":        func(f *Field) []string { return V.tags(r.Context(), f) },
+		// escaped html of new child, read by faForm.addInlineField
+		"inline_template": func(f *inlineForm) string {
+			return string(V.gt.Execute("inline_new", map[string]any{"inline": f}))
+		},
 	}, funcs)
 
 	if err := V.gt.Render(w, "templates/"+name, V.admin.funcs(fm), V.dict(r, data)); err != nil {
@@ -956,6 +1221,16 @@ func (V *ModelView) intoRow(uv url.Values, fields []*Field) *Row {
 	row := NewRow(fields, V.new())
 
 	for _, f := range fields {
+		if f.DBName == "" {
+			// has one and many to many
+			if f.Lookup != "" && uv.Has(f.FormName()) {
+				if row.assocs == nil {
+					row.assocs = map[string][]string{}
+				}
+				row.assocs[f.Name] = splitIds(uv.Get(f.FormName()))
+			}
+			continue
+		}
 		if !uv.Has(f.DBName) {
 			continue
 		}
@@ -963,6 +1238,12 @@ func (V *ModelView) intoRow(uv url.Values, fields []*Field) *Row {
 		var v any
 		v = uv.Get(f.DBName)
 
+		if f.Lookup != "" && v == "" {
+			// select2-ajax without selection
+			row.Set(f, nil)
+			continue
+		}
+
 		if len(f.Choices) > 0 {
 			// fix field_select2 formerly None(in python) to null
 			// TODO: fix in form.gotmpl
@@ -973,12 +1254,9 @@ func (V *ModelView) intoRow(uv url.Values, fields []*Field) *Row {
 
 		switch f.DataType {
 		case schema.Bool:
-			switch v {
-			case "false":
-				v = false
-			case "true":
-				v = true
-			default:
+			if b, err := strconv.ParseBool(cast.ToString(v)); err == nil {
+				v = b
+			} else {
 				log.Printf("not expected bool %v\n", v)
 				v = nil
 			}
@@ -1000,19 +1278,26 @@ func (V *ModelView) intoRow(uv url.Values, fields []*Field) *Row {
 
 		row.Set(f, v)
 	}
+	row.inlines = V.inlineEntries(uv)
 	return row
 }
 
 func (V *ModelView) applyJoins(db *gorm.DB) *gorm.DB {
+	db = V.joined(db)
+	for _, q := range V.preloads {
+		db = db.Preload(q.query, q.args...)
+	}
+	return db
+}
+
+// Joined tables without preloads, for count and filters of joined column
+func (V *ModelView) joined(db *gorm.DB) *gorm.DB {
 	for _, q := range V.joins {
 		db = db.Joins(q.query, q.args...)
 	}
 	for _, q := range V.innerJoins {
 		db = db.InnerJoins(q.query, q.args...)
 	}
-	for _, q := range V.preloads {
-		db = db.Preload(q.query, q.args...)
-	}
 	return db
 }
 
@@ -1037,29 +1322,39 @@ func (V *ModelView) applyQuery(db *gorm.DB, q *Query, count_only bool) *gorm.DB
 		})
 	}
 
+	if q.scope != nil {
+		ndb = ndb.Where(q.scope)
+	}
 	// filter
 	for _, inf := range q.filters {
 		filter := V.filters[inf.Index]
 		ndb = filter.Apply(ndb, inf.Query)
 	}
-	// search
+	// search of any column, grouped
 	if q.Search != "" && len(V.column_searchable_list) > 0 {
+		sdb := db.Session(&gorm.Session{NewDB: true})
 		for i, c := range V.column_searchable_list {
 			if i == 0 {
-				ndb = ndb.Where(c+" like ?", like(q.Search))
+				sdb = sdb.Where(c+" like ?", like(q.Search))
 			} else {
-				ndb = ndb.Or(c+" like ?", like(q.Search))
+				sdb = sdb.Or(c+" like ?", like(q.Search))
 			}
 		}
+		ndb = ndb.Where(sdb)
 	}
 	return ndb
 }
 
 func (V *ModelView) list(q *Query) *Result {
+	return V.listOf(q, V.fsList)
+}
+
+// Page of query, rows of the fields
+func (V *ModelView) listOf(q *Query, fields []*Field) *Result {
 	res := Result{Query: q}
 
 	var total int64
-	if err := V.applyQuery(V.db, q, true).
+	if err := V.joined(V.applyQuery(V.db, q, true)).
 		Model(V.Model.new()).
 		Count(&total).Error; err != nil {
 		res.Error = err
@@ -1069,6 +1364,7 @@ func (V *ModelView) list(q *Query) *Result {
 
 	ptr := V.newSlice()
 	db := V.applyQuery(V.db, q, false)
+	db = V.preloadTags(db, fields)
 	if err := V.applyJoins(db).
 		Find(ptr.Interface()).Error; err != nil {
 		res.Error = err
@@ -1080,56 +1376,192 @@ func (V *ModelView) list(q *Query) *Result {
 	res.Rows = make([]*Row, len)
 	for i := 0; i < len; i++ {
 		o := ptr.Elem().Index(i).Interface()
-		res.Rows[i] = NewRow(V.fsList, o)
+		res.Rows[i] = NewRow(fields, o)
 	}
 	return &res
 }
 
-func (V *ModelView) getOne(rowid string) (*Row, error) {
+// Row in list of the request
+func (V *ModelView) getOne(r *http.Request, rowid string) (*Row, error) {
+	row, err := V.getRow(rowid, V.fsList)
+	if err == nil && V.row_scope != nil {
+		if scope := V.row_scope(r); scope != nil {
+			err = V.take(V.db.Model(V.Model.new()).Where(scope), rowid, V.Model.new())
+		}
+	}
+	return row, err
+}
+
+func (V *ModelView) getRow(rowid string, fields []*Field) (*Row, error) {
+	w, err := V.where(rowid)
+	if err != nil {
+		return nil, err
+	}
 	ptr := V.Model.new()
-	db := V.applyJoins(V.db)
-	if err := db.Where(V.where(rowid)).First(ptr).Error; err != nil {
+	db := V.applyJoins(V.preloadTags(V.db, fields))
+	if err := db.Where(w).First(ptr).Error; err != nil {
 		return nil, err
 	}
-	return NewRow(V.fsList, ptr), nil
+	return NewRow(fields, ptr), nil
 }
 
-func (V *ModelView) update(rowid string, row *Row) error {
-	ptr := V.Model.new()
-	if rc := V.db.Model(ptr).
-		Where(V.where(rowid)).
-		Updates(row.Map); rc.Error != nil || rc.RowsAffected != 1 {
-		return rc.Error
+func (V *ModelView) update(ctx context.Context, rowid string, row *Row) error {
+	w, err := V.where(rowid)
+	if err != nil {
+		return err
 	}
-	return nil
+	return V.transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		before, err := V.audited(tx, rowid)
+		if err != nil {
+			return err
+		}
+
+		if len(V.hooks.on_model_change) > 0 {
+			if row, err = V.withCurrent(tx, rowid, row); err != nil {
+				return err
+			}
+			if err := V.onModelChange(ctx, row, false); err != nil {
+				return err
+			}
+		}
+
+		if len(row.Map) > 0 {
+			ptr := V.Model.new()
+			// unchanged row is 0 affected in MySQL, still save the relations
+			if err := tx.Model(ptr).
+				Where(w).
+				Updates(row.Map).Error; err != nil {
+				return err
+			}
+		}
+		if err := V.saveAssociations(ctx, tx, rowid, row); err != nil {
+			return err
+		}
+		if err := V.saveInlines(ctx, tx, rowid, row); err != nil {
+			return err
+		}
+
+		if len(V.hooks.after_model_change) > 0 {
+			if row, err = V.withCurrent(tx, rowid, row); err != nil {
+				return err
+			}
+			if err := V.afterModelChange(ctx, row, false); err != nil {
+				return err
+			}
+		}
+
+		after, err := V.audited(tx, rowid)
+		if err != nil || len(before) == 0 || len(after) == 0 {
+			return err
+		}
+		return V.audit(ctx, tx, AuditUpdate, V.pkOf(before[0]), before[0], after[0])
+	})
 }
 
-func (V *ModelView) deleteOne(rowid string) error {
-	ptr := V.Model.new()
-	rc := V.db.Delete(ptr, V.where(rowid))
-	return rc.Error
+func (V *ModelView) deleteOne(ctx context.Context, rowid string) error {
+	_, err := V.deleteBatch(ctx, []string{rowid})
+	return err
 }
-func (V *ModelView) deleteBatch(rowid []string) *gorm.DB {
-	ptr := V.Model.new()
-	ndb := V.db.Model(ptr)
-	for i, id := range rowid {
-		if i == 0 {
-			ndb = ndb.Where(V.where(id))
-		} else {
-			ndb = ndb.Or(V.where(id))
+
+func (V *ModelView) deleteBatch(ctx context.Context, rowid []string) (int64, error) {
+	var affected int64
+	err := V.transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		before, err := V.audited(tx, rowid...)
+		if err != nil {
+			return err
 		}
-	}
-	return ndb.Delete(ptr)
+
+		if len(V.hooks.on_model_delete) > 0 {
+			for _, id := range rowid {
+				row, err := V.loadRow(tx, id)
+				if err != nil {
+					return err
+				}
+				if row == nil {
+					continue
+				}
+				if err := V.onModelDelete(ctx, row); err != nil {
+					return err
+				}
+			}
+		}
+
+		ptr := V.Model.new()
+		ndb := tx.Model(ptr)
+		n := 0
+		for _, id := range rowid {
+			// malformed id matches no record
+			w, err := V.where(id)
+			if err != nil {
+				continue
+			}
+			if n == 0 {
+				ndb = ndb.Where(w)
+			} else {
+				ndb = ndb.Or(w)
+			}
+			n++
+		}
+		if n == 0 {
+			return nil
+		}
+		rc := ndb.Delete(ptr)
+		if rc.Error != nil {
+			return rc.Error
+		}
+		affected = rc.RowsAffected
+
+		for _, b := range before {
+			if err := V.audit(ctx, tx, AuditDelete, V.pkOf(b), b, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return affected, err
 }
 
 // row -> Model().Create() RETURNING *
-func (V *ModelView) create(row *Row) error {
-	ptr := V.Model.new()
+func (V *ModelView) create(ctx context.Context, row *Row) error {
+	return V.transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		if err := V.onModelChange(ctx, row, true); err != nil {
+			return err
+		}
 
-	if rc := V.db.Model(ptr).
-		Clauses(clause.Returning{}). // RETURNING *
-		Create(row.Map); rc.Error != nil || rc.RowsAffected != 1 {
-		return rc.Error
-	}
-	return nil
+		ptr := V.Model.new()
+		if rc := tx.Model(ptr).
+			Clauses(clause.Returning{}). // RETURNING *
+			Create(row.Map); rc.Error != nil {
+			return rc.Error
+		} else if rc.RowsAffected == 0 {
+			return errors.New(gettext("Record was not created."))
+		}
+
+		pk := V.pkOf(row.Map)
+		if err := V.saveAssociations(ctx, tx, pk, row); err != nil {
+			return err
+		}
+		if err := V.saveInlines(ctx, tx, pk, row); err != nil {
+			return err
+		}
+		if len(V.hooks.after_model_change) > 0 {
+			cur, err := V.withCurrent(tx, pk, row)
+			if err != nil {
+				return err
+			}
+			if err := V.afterModelChange(ctx, cur, true); err != nil {
+				return err
+			}
+		}
+
+		after, err := V.audited(tx, pk)
+		if err != nil {
+			return err
+		}
+		if len(after) == 0 {
+			// without RETURNING
+			after = []snapshot{row.Map}
+		}
+		return V.audit(ctx, tx, AuditCreate, pk, nil, after[0])
+	})
 }
@@ -0,0 +1,180 @@
+package gadm
+
+import (
+	"context"
+	"errors"
+	"gadm/examples/sqla"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddAction(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	var approved []string
+	admin.AddView(NewModelView(sqla.Company{}, db).
+		AddAction("approve", "Approve", "Approve selected companies?", func(ctx context.Context, ids []string) error {
+			approved = append(approved, ids...)
+			return nil
+		}).
+		AddAction("fail", "Fail", "", func(ctx context.Context, ids []string) error {
+			return errors.New("can not fail")
+		}).
+		SetRequiredRoles(Permission("approve"), "approver"))
+	admin.freeze()
+	db.Create(&sqla.Company{Name: "Acme"})
+	db.Create(&sqla.Company{Name: "Globex"})
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	admin.Security().AddRoles(alice, "approver")
+	admin.Security().CreateUser("bob@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	body := c.do("GET", "/admin/company/", nil).Body.String()
+	is.Contains(body, "modelActions.execute('delete')")
+	is.Contains(body, "modelActions.execute('approve')")
+	is.Contains(body, "modelActions.execute('fail')")
+	is.Contains(body, "Approve selected companies?")
+
+	w := c.post("/admin/company/", "/admin/company/action", url.Values{"action": {"approve"}, "rowid": {"1", "2"}})
+	is.Equal(302, w.Code)
+	is.Equal([]string{"1", "2"}, approved)
+	is.Contains(c.do("GET", "/admin/company/", nil).Body.String(), "Approve: 2 records were processed.")
+
+	c.post("/admin/company/", "/admin/company/action", url.Values{"action": {"fail"}, "rowid": {"1"}})
+	is.Contains(c.do("GET", "/admin/company/", nil).Body.String(), "can not fail")
+
+	// malformed id matches no record, not the first one
+	approved = nil
+	c.post("/admin/company/", "/admin/company/action", url.Values{"action": {"approve"}, "rowid": {"2,9"}})
+	is.Nil(approved)
+	c.post("/admin/company/", "/admin/company/action", url.Values{"action": {"approve"}, "rowid": {"2", "7,7"}})
+	is.Equal([]string{"2"}, approved)
+
+	// unknown action does nothing
+	is.Equal(302, c.post("/admin/company/", "/admin/company/action", url.Values{"action": {"nope"}, "rowid": {"1"}}).Code)
+
+	// bob is not an approver
+	cb := newTestClient(admin)
+	cb.post("/admin/login", "/admin/login", url.Values{"email": {"bob@example.com"}, "password": {"secret"}})
+	body = cb.do("GET", "/admin/company/", nil).Body.String()
+	is.NotContains(body, "modelActions.execute('approve')")
+	is.Contains(body, "modelActions.execute('fail')")
+	cb.post("/admin/company/", "/admin/company/action", url.Values{"action": {"approve"}, "rowid": {"2"}})
+	is.Equal([]string{"2"}, approved)
+
+	// name of action is checked as permission, built-in ones are reserved
+	mv := NewModelView(sqla.Company{}, db)
+	for _, name := range []string{"delete", "edit", "export", ""} {
+		is.Panics(func() { mv.AddAction(name, "X", "", nil) }, name)
+	}
+}
+
+func TestAddRowAction(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	var archived []string
+	admin.AddView(NewModelView(sqla.Company{}, db).
+		AddRowAction(RowAction{Name: "site", Title: "Open site", Icon: "fa fa-globe",
+			URL: func(pk string) string { return "/sites/" + pk }}).
+		AddRowAction(RowAction{Name: "archive", Title: "Archive", Icon: "fa fa-archive",
+			Confirmation: "Archive this company?",
+			Handler: func(ctx context.Context, pk string) error {
+				archived = append(archived, pk)
+				return nil
+			}}).
+		SetRequiredRoles(Permission("archive"), "archiver"))
+	admin.freeze()
+	db.Create(&sqla.Company{Name: "Acme"})
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	admin.Security().AddRoles(alice, "archiver")
+	admin.Security().CreateUser("bob@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	body := c.do("GET", "/admin/company/", nil).Body.String()
+	is.Contains(body, `href="/sites/1" title="Open site"`)
+	is.Contains(body, `<span class="fa fa-globe"></span>`)
+	is.Contains(body, `action="/admin/company/row_action?id=1&amp;name=archive&amp;url=%2Fadmin%2Fcompany%2F"`)
+	is.Contains(body, "Archive this company?")
+
+	w := c.post("/admin/company/", "/admin/company/row_action?id=1&name=archive", url.Values{})
+	is.Equal(302, w.Code)
+	is.Equal([]string{"1"}, archived)
+	is.Contains(c.do("GET", "/admin/company/", nil).Body.String(), "Archive: record was processed.")
+
+	// malformed id matches no record
+	c.post("/admin/company/", "/admin/company/row_action?id=1,1&name=archive", url.Values{})
+	is.Len(archived, 1)
+
+	// GET does nothing
+	c.do("GET", "/admin/company/row_action?id=1&name=archive", nil)
+	is.Len(archived, 1)
+
+	// bob is not an archiver
+	cb := newTestClient(admin)
+	cb.post("/admin/login", "/admin/login", url.Values{"email": {"bob@example.com"}, "password": {"secret"}})
+	body = cb.do("GET", "/admin/company/", nil).Body.String()
+	is.Contains(body, `href="/sites/1"`)
+	is.NotContains(body, "name=archive")
+	cb.post("/admin/company/", "/admin/company/row_action?id=1&name=archive", url.Values{})
+	is.Len(archived, 1)
+
+	is.Panics(func() { NewModelView(sqla.Company{}, db).AddRowAction(RowAction{Name: "share"}) })
+}
+
+func TestModal(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	admin.AddView(NewModelView(Gadget{}, db).
+		SetCreateModal(true).
+		SetEditModal(true).
+		SetDetailsModal(true))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&Gadget{Name: "Gear", Stock: 2})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	body := c.do("GET", "/admin/gadget/", nil).Body.String()
+	is.Contains(body, `href="/admin/gadget/new?modal=1&amp;url=%2Fadmin%2Fgadget%2F" data-toggle="modal"`)
+	is.Contains(body, `href="/admin/gadget/edit?id=1&amp;modal=1&amp;url=%2Fadmin%2Fgadget%2F" data-toggle="modal"`)
+	is.Contains(body, `href="/admin/gadget/details?id=1&amp;modal=1&amp;url=%2Fadmin%2Fgadget%2F" data-toggle="modal"`)
+	is.Contains(body, `<div class="modal fade" id="fa_modal_window"`)
+	is.Contains(body, "admin/js/modal_form.js")
+
+	// fragments only
+	w := c.do("GET", "/admin/gadget/new?modal=1", nil)
+	is.Equal(200, w.Code)
+	is.NotContains(w.Body.String(), "<html>")
+	is.Contains(w.Body.String(), `<form action="/admin/gadget/new?modal=1"`)
+	is.NotContains(w.Body.String(), "_add_another")
+
+	body = c.do("GET", "/admin/gadget/details?id=1&modal=1", nil).Body.String()
+	is.NotContains(body, "<html>")
+	is.Contains(body, "<td>Gear</td>")
+
+	// errors render the fragment again
+	w = c.post("/admin/gadget/new?modal=1", "/admin/gadget/new?modal=1", url.Values{"name": {""}})
+	is.Equal(200, w.Code)
+	is.NotContains(w.Body.String(), "<html>")
+	is.Contains(w.Body.String(), "<li>This field is required.</li>")
+
+	// saved, the list is refreshed by script
+	is.Equal(204, c.post("/admin/gadget/new?modal=1", "/admin/gadget/new?modal=1", url.Values{"name": {"Cog"}}).Code)
+	is.Equal(204, c.post("/admin/gadget/edit?id=1&modal=1", "/admin/gadget/edit?id=1&modal=1", url.Values{"name": {"Wheel"}}).Code)
+	body = c.do("GET", "/admin/gadget/", nil).Body.String()
+	is.Contains(body, "Record was successfully created.")
+	is.Contains(body, "Record was successfully saved.")
+	is.Contains(body, "Cog")
+	is.Contains(body, "Wheel")
+}
@@ -0,0 +1,313 @@
+package gadm
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm/schema"
+)
+
+// OpenAPI 3 document of the rest api of views, see ModelView.SetApi.
+// Only views and operations allowed for current user.
+func (A *Admin) openapi(r *http.Request) map[string]any {
+	paths := map[string]any{}
+	schemas := map[string]any{
+		"Error": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"error": map[string]any{"type": "string"},
+				"errors": map[string]any{
+					"type":                 "object",
+					"description":          "messages by column",
+					"additionalProperties": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+				},
+			},
+			"required": []string{"error"},
+		},
+	}
+	for _, v := range A.views {
+		mv, ok := v.(*ModelView)
+		if !ok || !mv.can_api || !mv.can(r, PermList) {
+			continue
+		}
+		maps.Copy(paths, mv.openapiPaths(r))
+		maps.Copy(schemas, mv.openapiSchemas())
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   A.Menu.Name,
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas,
+			"securitySchemes": map[string]any{
+				"session": map[string]any{"type": "apiKey", "in": "cookie", "name": A.sessionKey},
+				"csrf": map[string]any{"type": "apiKey", "in": "header", "name": "X-CSRF-Token",
+					"description": "required by POST, PATCH and DELETE, returned in the header of GET"},
+				"bearer": map[string]any{"type": "http", "scheme": "bearer",
+					"description": "personal API token, without csrf"},
+			},
+		},
+		"security": []any{map[string]any{"session": []string{}}, map[string]any{"bearer": []string{}}},
+	}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(s any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": s}}
+}
+
+func (V *ModelView) openapiPaths(r *http.Request) map[string]any {
+	name := V.schema.Name
+	tags := []string{name}
+	writeSecurity := []any{map[string]any{"session": []string{}, "csrf": []string{}}, map[string]any{"bearer": []string{}}}
+	failures := func(codes ...int) map[string]any {
+		res := map[string]any{}
+		for _, code := range append([]int{http.StatusUnauthorized, http.StatusForbidden}, codes...) {
+			res[fmt.Sprint(code)] = map[string]any{
+				"description": http.StatusText(code),
+				"content":     jsonContent(ref("Error")),
+			}
+		}
+		return res
+	}
+	respond := func(res map[string]any, code int, desc string, s any) map[string]any {
+		o := map[string]any{"description": desc}
+		if s != nil {
+			o["content"] = jsonContent(s)
+		}
+		res[fmt.Sprint(code)] = o
+		return res
+	}
+
+	collection := map[string]any{
+		"get": map[string]any{
+			"tags":        tags,
+			"operationId": "list" + name,
+			"summary":     gettext("List of %s", V.label()),
+			"parameters":  V.openapiParameters(),
+			"responses": respond(failures(http.StatusBadRequest), http.StatusOK, "page of records", map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"total":     map[string]any{"type": "integer"},
+					"page":      map[string]any{"type": "integer"},
+					"page_size": map[string]any{"type": "integer"},
+					"data":      map[string]any{"type": "array", "items": ref(name)},
+				},
+				"required": []string{"total", "page", "page_size", "data"},
+			}),
+		},
+	}
+	if V.can(r, PermCreate) {
+		collection["post"] = map[string]any{
+			"tags":        tags,
+			"operationId": "create" + name,
+			"summary":     gettext("Create %s", V.label()),
+			"security":    writeSecurity,
+			"requestBody": map[string]any{"required": true, "content": jsonContent(ref(name + "Input"))},
+			"responses": respond(failures(http.StatusBadRequest, http.StatusInternalServerError),
+				http.StatusCreated, "created record", ref(name)),
+		}
+	}
+
+	idParam := map[string]any{
+		"name": "id", "in": "path", "required": true,
+		"description": "primary key, " + strings.Join(lo.Map(V.schema.PrimaryFields, func(f *schema.Field, _ int) string {
+			return f.DBName
+		}), ",") + " when composite",
+		"schema": map[string]any{"type": "string"},
+	}
+	one := map[string]any{
+		"parameters": []any{idParam},
+		"get": map[string]any{
+			"tags":        tags,
+			"operationId": "get" + name,
+			"summary":     gettext("Details of %s", V.label()),
+			"responses":   respond(failures(http.StatusNotFound), http.StatusOK, "record", ref(name)),
+		},
+	}
+	if V.can(r, PermEdit) {
+		one["patch"] = map[string]any{
+			"tags":        tags,
+			"operationId": "update" + name,
+			"summary":     gettext("Update %s", V.label()),
+			"security":    writeSecurity,
+			"requestBody": map[string]any{"required": true, "content": jsonContent(ref(name + "Patch"))},
+			"responses": respond(failures(http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+				http.StatusOK, "updated record", ref(name)),
+		}
+	}
+	if V.can(r, PermDelete) {
+		one["delete"] = map[string]any{
+			"tags":        tags,
+			"operationId": "delete" + name,
+			"summary":     gettext("Delete %s", V.label()),
+			"security":    writeSecurity,
+			"responses": respond(failures(http.StatusNotFound, http.StatusInternalServerError),
+				http.StatusNoContent, "deleted", nil),
+		}
+	}
+
+	base := must(V.Blueprint.GetUrl(".api"))
+	return map[string]any{base: collection, base + "/{id}": one}
+}
+
+// Parameters of Query
+func (V *ModelView) openapiParameters() []any {
+	columns := lo.Map(V.fsList, func(f *Field, i int) string {
+		return fmt.Sprintf("%d: %s", i, f.DBName)
+	})
+	ps := []any{
+		map[string]any{"name": "page", "in": "query", "description": "0 based",
+			"schema": map[string]any{"type": "integer", "minimum": 0}},
+		map[string]any{"name": "page_size", "in": "query",
+			"schema": map[string]any{"type": "integer", "minimum": 1, "default": V.page_size}},
+		map[string]any{"name": "sort", "in": "query", "description": "index of column, " + strings.Join(columns, ", "),
+			"schema": map[string]any{"type": "string"}},
+		map[string]any{"name": "desc", "in": "query", "schema": map[string]any{"type": "boolean"}},
+	}
+	if len(V.column_searchable_list) > 0 {
+		ps = append(ps, map[string]any{"name": "search", "in": "query",
+			"description": "like any of " + strings.Join(V.column_searchable_list, ", "),
+			"schema":      map[string]any{"type": "string"}})
+	}
+	for i, f := range V.filters {
+		s := map[string]any{"type": "string"}
+		if len(f.Options()) > 0 {
+			s["enum"] = lo.Map(f.Options(), func(o []string, _ int) string { return o[0] })
+		}
+		ps = append(ps, map[string]any{
+			"name":        fmt.Sprintf("flt0_%d", i),
+			"in":          "query",
+			"description": f.Label() + " " + f.Operation(),
+			"schema":      s,
+		})
+	}
+	return ps
+}
+
+// Record of list columns, input of create and patch of edit
+func (V *ModelView) openapiSchemas() map[string]any {
+	name := V.schema.Name
+	object := func(fields []*Field, required func(*Field) bool) map[string]any {
+		props := map[string]any{}
+		req := []string{}
+		for _, f := range fields {
+			if f.DBName == "" && f.Lookup == "" {
+				continue
+			}
+			props[f.FormName()] = V.fieldSchema(f)
+			if required(f) {
+				req = append(req, f.FormName())
+			}
+		}
+		o := map[string]any{"type": "object", "properties": props}
+		if len(req) > 0 {
+			slices.Sort(req)
+			o["required"] = req
+		}
+		return o
+	}
+	writable := lo.Filter(V.fsEdit, func(f *Field, _ int) bool { return !f.Readonly })
+
+	return map[string]any{
+		name: object(lo.Filter(V.fsList, func(f *Field, _ int) bool {
+			return f.DBName != ""
+		}), func(f *Field) bool { return true }),
+		name + "Input": object(V.fsNew, required),
+		name + "Patch": object(writable, func(*Field) bool { return false }),
+	}
+}
+
+// Type of column in json of Row
+func (V *ModelView) fieldSchema(f *Field) map[string]any {
+	s := map[string]any{}
+	if f.DBName == "" {
+		// has one and many to many, by primary keys
+		id := map[string]any{"type": "string"}
+		if rel, ok := V.schema.Relationships.Relations[f.Name]; ok && rel.FieldSchema.PrioritizedPrimaryField != nil {
+			id = V.fieldSchema(&Field{Field: rel.FieldSchema.PrioritizedPrimaryField})
+			delete(id, "readOnly")
+		}
+		if f.Multiple {
+			return map[string]any{"type": "array", "items": id}
+		}
+		id["nullable"] = true
+		return id
+	}
+
+	switch f.DataType {
+	case schema.Bool:
+		s["type"] = "boolean"
+	case schema.Int:
+		s["type"] = "integer"
+		s["format"] = "int64"
+	case schema.Uint:
+		s["type"] = "integer"
+		s["minimum"] = 0
+	case schema.Float:
+		s["type"] = "number"
+	case schema.Time:
+		s["type"] = "string"
+		s["format"] = "date-time"
+	case schema.Bytes:
+		s["type"] = "string"
+		s["format"] = "byte"
+	default:
+		s["type"] = "string"
+		if f.Size > 0 {
+			s["maxLength"] = f.Size
+		}
+	}
+	if len(f.Choices) > 0 {
+		s["enum"] = lo.Map(f.Choices, func(c Choice, _ int) any { return c.Value })
+	}
+	if !f.NotNull && !f.PrimaryKey {
+		s["nullable"] = true
+	}
+	if f.PrimaryKey && f.AutoIncrement {
+		s["readOnly"] = true
+	}
+	if f.Description != "" {
+		s["description"] = f.Description
+	}
+	return s
+}
+
+func (A *Admin) openapiHandler(w http.ResponseWriter, r *http.Request) {
+	ReplyJson(w, http.StatusOK, A.openapi(r))
+}
+
+// Operations of the document, in order of path
+func (A *Admin) openapiHtmlHandler(w http.ResponseWriter, r *http.Request) {
+	type operation struct {
+		Method, Path, OperationId, Summary string
+	}
+	doc := A.openapi(r)
+	paths := doc["paths"].(map[string]any)
+	ops := []operation{}
+	for _, path := range slices.Sorted(maps.Keys(paths)) {
+		item := paths[path].(map[string]any)
+		for _, method := range []string{"get", "post", "patch", "delete"} {
+			if o, ok := item[method].(map[string]any); ok {
+				ops = append(ops, operation{strings.ToUpper(method), path,
+					o["operationId"].(string), o["summary"].(string)})
+			}
+		}
+	}
+
+	A.Render(w, r, "templates/openapi.gotmpl", nil, map[string]any{
+		"operations": ops,
+		"spec_url":   must(A.Blueprint.GetUrl(".openapi")),
+	})
+}
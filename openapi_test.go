@@ -0,0 +1,91 @@
+package gadm
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenapi(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Gadget{}, db).
+		SetApi(true).
+		SetColumnSearchableList("name").
+		SetColumnFilters("code").
+		SetRequiredRoles(PermDelete, "admin"))
+	db.AutoMigrate(&Widget{})
+	admin.AddView(NewModelView(Widget{}, db))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w := c.do("GET", "/admin/openapi.json", nil)
+	is.Equal(200, w.Code)
+	var doc struct {
+		Openapi    string
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]map[string]any
+				Required   []string
+			}
+		}
+	}
+	is.Nil(json.Unmarshal(w.Body.Bytes(), &doc))
+	is.Equal("3.0.3", doc.Openapi)
+
+	// only views with api, and allowed operations
+	is.Len(doc.Paths, 2)
+	is.ElementsMatch([]string{"get", "post"}, keys(doc.Paths["/admin/gadget/api"]))
+	is.ElementsMatch([]string{"parameters", "get", "patch"}, keys(doc.Paths["/admin/gadget/api/{id}"]))
+
+	var list struct {
+		OperationId string
+		Parameters  []struct {
+			Name        string
+			Description string
+		}
+	}
+	is.Nil(json.Unmarshal(doc.Paths["/admin/gadget/api"]["get"], &list))
+	is.Equal("listGadget", list.OperationId)
+	names := []string{}
+	for _, p := range list.Parameters {
+		names = append(names, p.Name)
+	}
+	is.Equal([]string{"page", "page_size", "sort", "desc", "search", "flt0_0", "flt0_1"}, names[:7])
+	is.Equal("Code like", list.Parameters[5].Description)
+
+	gadget := doc.Components.Schemas["Gadget"]
+	is.Equal(map[string]any{"type": "integer", "minimum": 0.0, "readOnly": true}, gadget.Properties["id"])
+	is.Equal(map[string]any{"type": "string", "maxLength": 8.0}, gadget.Properties["name"])
+	is.Equal(map[string]any{"type": "integer", "format": "int64", "nullable": true}, gadget.Properties["stock"])
+	is.Equal(map[string]any{"type": "number", "nullable": true}, gadget.Properties["price"])
+	is.Equal([]string{"name"}, doc.Components.Schemas["GadgetInput"].Required)
+	is.NotContains(doc.Components.Schemas["GadgetInput"].Properties, "id")
+	is.Nil(doc.Components.Schemas["GadgetPatch"].Required)
+	is.NotContains(doc.Components.Schemas, "Widget")
+
+	body := c.do("GET", "/admin/openapi", nil).Body.String()
+	is.Contains(body, `<code>/admin/gadget/api/{id}</code>`)
+	is.Contains(body, "updateGadget")
+	is.NotContains(body, "deleteGadget")
+}
+
+type Widget struct {
+	Id   uint `gorm:"primaryKey"`
+	Name string
+}
+
+func keys[V any](m map[string]V) []string {
+	ks := []string{}
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
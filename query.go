@@ -8,6 +8,7 @@ import (
 
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
+	"gorm.io/gorm/clause"
 )
 
 type Query struct {
@@ -24,6 +25,8 @@ type Query struct {
 	filters []*InputFilter
 	args    []string
 	base    string // base path
+	// rows visible to the request, nil for all
+	scope clause.Expression
 
 	default_page_size int
 }
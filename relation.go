@@ -0,0 +1,252 @@
+package gadm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Editable relationships in form, as select2-ajax of lookup refer:
+// belongs to by the foreign key, has one and many to many by the association.
+// Has many and polymorphic ones are left out of the form.
+func (V *ModelView) setupRelations(fs []*Field) {
+	for _, rel := range V.schema.Relationships.Relations {
+		if rel.Polymorphic != nil || rel.Type == schema.HasMany {
+			continue
+		}
+		switch rel.Type {
+		case schema.BelongsTo:
+			if len(rel.References) != 1 {
+				continue
+			}
+			if f := findField(fs, rel.References[0].ForeignKey); f != nil {
+				f.Lookup = V.referTo(rel)
+			}
+		case schema.HasOne, schema.Many2Many:
+			if len(rel.FieldSchema.PrimaryFields) != 1 {
+				continue
+			}
+			if f := findField(fs, rel.Field); f != nil {
+				f.Lookup = V.referTo(rel)
+				f.Multiple = rel.Type == schema.Many2Many
+			}
+		}
+	}
+}
+
+func findField(fs []*Field, sf *schema.Field) *Field {
+	for _, f := range fs {
+		if f.Field == sf {
+			return f
+		}
+	}
+	return nil
+}
+
+// Is the field in form: not the struct of belongs to, nor has many
+func (V *ModelView) inForm(f *Field) bool {
+	if f.DBName != "" {
+		return true
+	}
+	return f.Lookup != ""
+}
+
+// Name of lookup refer for the related model, added when missing.
+// Label is the first string column by default.
+func (V *ModelView) referTo(rel *schema.Relationship) string {
+	name := rel.FieldSchema.Table
+	if _, ok := V.lookupRefers[name]; ok {
+		return name
+	}
+
+	m := NewModel(reflect.New(rel.FieldSchema.ModelType).Interface())
+	rf := &refer{model: m}
+	for _, f := range m.schema.Fields {
+		if f.DBName != "" && !f.PrimaryKey && f.DataType == schema.String {
+			rf.fields = []string{f.DBName}
+			break
+		}
+	}
+	if V.lookupRefers == nil {
+		V.lookupRefers = map[string]*refer{}
+	}
+	V.lookupRefers[name] = rf
+	return name
+}
+
+// Label of one record, like [id, label] of Lookup
+func (rf *refer) label(ctx context.Context, o any) string {
+	rv := reflect.Indirect(reflect.ValueOf(o))
+	m := map[string]any{}
+	for _, f := range rf.model.schema.Fields {
+		if f.DBName != "" {
+			m[f.DBName], _ = f.ValueOf(ctx, rv)
+		}
+	}
+	return cast.ToString(rf.rows([]map[string]any{m})[0][1])
+}
+
+// Preload many to many of fields, shown as tags
+func (V *ModelView) preloadTags(db *gorm.DB, fields []*Field) *gorm.DB {
+	for _, f := range fields {
+		if f.Multiple {
+			db = db.Preload(f.Name)
+		}
+	}
+	return db
+}
+
+// Labels of associated records in many to many field
+func (V *ModelView) tags(ctx context.Context, f *Field) []string {
+	rf := V.lookupRefers[f.Lookup]
+	rv := reflect.Indirect(reflect.ValueOf(f.Value))
+	if rf == nil || rv.Kind() != reflect.Slice {
+		return nil
+	}
+	ts := []string{}
+	for i := 0; i < rv.Len(); i++ {
+		ts = append(ts, rf.label(ctx, rv.Index(i).Interface()))
+	}
+	return ts
+}
+
+// Records of ids in [id, label]
+func (rf *refer) byIds(db *gorm.DB, ids []string) [][]any {
+	if len(ids) == 0 {
+		return [][]any{}
+	}
+	pk := rf.model.schema.PrioritizedPrimaryField
+	if pk == nil {
+		return [][]any{}
+	}
+	var ms []map[string]any
+	if err := db.Table(rf.model.schema.Table).Select(rf.columns()).
+		Where(pk.DBName+" IN ?", ids).Find(&ms).Error; err != nil {
+		return [][]any{}
+	}
+	return rf.rows(ms)
+}
+
+// Name in form, db name or snake case of association, prefixed in inline form
+func (f *Field) FormName() string {
+	name := f.DBName
+	if name == "" {
+		name = Namer.ColumnName("", f.Name)
+	}
+	if f.Prefix != "" {
+		return f.Prefix + "-" + name
+	}
+	return name
+}
+
+// Fill LookupValue and LookupJson of lookup fields in row
+func (V *ModelView) fillLookups(ctx context.Context, row *Row) {
+	if row == nil {
+		return
+	}
+	for _, f := range row.Fields {
+		rf, ok := V.lookupRefers[f.Lookup]
+		if f.Lookup == "" || !ok {
+			continue
+		}
+
+		var ids []string
+		switch v := f.Value.(type) {
+		case string:
+			// submitted
+			ids = splitIds(v)
+		default:
+			if f.DBName != "" {
+				ids = splitIds(f.Display())
+			} else {
+				ids = V.associated(ctx, row.GetPkValue(), f)
+			}
+		}
+
+		items := rf.byIds(V.db.WithContext(ctx), ids)
+		f.LookupValue = strings.Join(ids, ",")
+		if f.Multiple {
+			f.LookupJson = jsonify(items)
+		} else if len(items) > 0 {
+			f.LookupJson = jsonify(items[0])
+		} else {
+			f.LookupJson = "null"
+		}
+	}
+}
+
+func splitIds(s string) []string {
+	ids := []string{}
+	for _, id := range strings.Split(s, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Primary keys of associated records
+func (V *ModelView) associated(ctx context.Context, rowid string, f *Field) []string {
+	if rowid == "" {
+		return nil
+	}
+	ptr := V.Model.new()
+	tx := V.Tx(ctx)
+	if err := V.take(tx, rowid, ptr); err != nil {
+		return nil
+	}
+
+	rel := V.schema.Relationships.Relations[f.Name]
+	slice := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType))
+	if err := tx.Model(ptr).Association(f.Name).Find(slice.Interface()); err != nil {
+		return nil
+	}
+	pk := rel.FieldSchema.PrioritizedPrimaryField
+	ids := []string{}
+	for i := 0; i < slice.Elem().Len(); i++ {
+		v, _ := pk.ValueOf(ctx, slice.Elem().Index(i))
+		ids = append(ids, cast.ToString(v))
+	}
+	return ids
+}
+
+// Replace associations of record with submitted ids, inside tx
+func (V *ModelView) saveAssociations(ctx context.Context, tx *gorm.DB, rowid string, row *Row) error {
+	if len(row.assocs) == 0 {
+		return nil
+	}
+	ptr := V.Model.new()
+	if err := V.take(tx, rowid, ptr); err != nil {
+		return err
+	}
+
+	for name, ids := range row.assocs {
+		rel := V.schema.Relationships.Relations[name]
+		slice := reflect.New(reflect.SliceOf(reflect.PointerTo(rel.FieldSchema.ModelType)))
+		if len(ids) > 0 {
+			pk := rel.FieldSchema.PrioritizedPrimaryField
+			if err := tx.Where(pk.DBName+" IN ?", ids).Find(slice.Interface()).Error; err != nil {
+				return err
+			}
+		}
+
+		as := tx.Model(ptr).Association(name)
+		var err error
+		switch n := slice.Elem().Len(); {
+		case n == 0:
+			err = as.Clear()
+		case rel.Type == schema.HasOne:
+			err = as.Replace(slice.Elem().Index(0).Interface())
+		default:
+			err = as.Replace(slice.Elem().Interface())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package gadm
+
+import (
+	"gadm/examples/sqla"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelationForm(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(sqla.Company{}, db))
+	admin.AddView(NewModelView(sqla.Employee{}, db))
+	admin.AddView(NewModelView(sqla.Language{}, db))
+	admin.AddView(NewModelView(sqla.Student{}, db))
+	admin.AddView(NewModelView(sqla.CreditCard{}, db))
+	admin.AddView(NewModelView(sqla.User{}, db))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&[]sqla.Company{{Id: 31, Name: "talk ltd"}, {Id: 32, Name: "chat ltd"}})
+	db.Create(&[]sqla.Language{{Id: 1, Name: "Go"}, {Id: 2, Name: "Python"}, {Id: 3, Name: "Rust"}})
+	db.Create(&sqla.CreditCard{Id: 7, Number: "4242"})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	// belongs to, by the foreign key
+	body := c.do("GET", "/admin/employee/new", nil).Body.String()
+	is.Contains(body, `data-role="select2-ajax"`)
+	is.Contains(body, `data-url="/admin/employee/ajax/lookup?name=company"`)
+	is.Contains(body, `id="company_id" name="company_id" type="hidden"`)
+	is.NotContains(body, `type="number" id="company_id"`)
+	is.NotContains(body, `name="company"`)
+
+	w := c.do("GET", "/admin/employee/ajax/lookup?name=company&query=talk&offset=0&limit=10", nil)
+	is.JSONEq(`[[31, "talk ltd"]]`, w.Body.String())
+
+	is.Equal(302, c.post("/admin/employee/new", "/admin/employee/new", url.Values{"name": {"Alice"}, "company_id": {"31"}}).Code)
+	var e sqla.Employee
+	db.First(&e)
+	is.Equal(int64(31), e.CompanyId.Int64)
+
+	body = c.do("GET", "/admin/employee/edit?id=1", nil).Body.String()
+	is.Contains(body, `data-json="[31,&#34;talk ltd&#34;]"`)
+	is.Contains(body, `value="31"`)
+
+	is.Equal(302, c.post("/admin/employee/edit?id=1", "/admin/employee/edit?id=1", url.Values{"name": {"Alice"}, "company_id": {""}}).Code)
+	e = sqla.Employee{}
+	db.First(&e)
+	is.False(e.CompanyId.Valid)
+
+	// many to many
+	body = c.do("GET", "/admin/student/new", nil).Body.String()
+	is.Contains(body, `data-multiple="1"`)
+	is.Contains(body, `data-url="/admin/student/ajax/lookup?name=language"`)
+	is.Equal(302, c.post("/admin/student/new", "/admin/student/new", url.Values{"name": {"Bob"}, "languages": {"1,2"}}).Code)
+	var s sqla.Student
+	db.Preload("Languages").First(&s)
+	is.Len(s.Languages, 2)
+
+	body = c.do("GET", "/admin/student/edit?id=1", nil).Body.String()
+	is.Contains(body, `value="1,2"`)
+	is.Contains(body, `&#34;Python&#34;`)
+
+	is.Equal(302, c.post("/admin/student/edit?id=1", "/admin/student/edit?id=1", url.Values{"name": {"Bob"}, "languages": {"3"}}).Code)
+	s = sqla.Student{}
+	db.Preload("Languages").First(&s)
+	is.Len(s.Languages, 1)
+	is.Equal("Rust", s.Languages[0].Name)
+
+	// has one
+	is.Equal(302, c.post("/admin/user/new", "/admin/user/new", url.Values{"name": {"Carol"}, "credit_card": {"7"}}).Code)
+	var card sqla.CreditCard
+	db.First(&card, 7)
+	is.Equal(uint(1), card.UserID)
+	is.Contains(c.do("GET", "/admin/user/edit?id=1", nil).Body.String(), `data-json="[7,&#34;4242&#34;]"`)
+}
+
+func TestRelationTags(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(sqla.Language{}, db))
+	admin.AddView(NewModelView(sqla.Student{}, db).SetDetailsModal(true))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&sqla.Student{Name: "Bob", Languages: []sqla.Language{{Name: "Go"}, {Name: "Rust"}}})
+	db.Create(&sqla.Student{Name: "Eve"})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	tags := `<span class="badge badge-secondary mr-1">Go</span><span class="badge badge-secondary mr-1">Rust</span>`
+	body := c.do("GET", "/admin/student/", nil).Body.String()
+	is.Contains(body, tags)
+	is.Contains(c.do("GET", "/admin/student/details?id=1", nil).Body.String(), tags)
+	is.Contains(c.do("GET", "/admin/student/details?id=1&modal=1", nil).Body.String(), tags)
+	is.NotContains(c.do("GET", "/admin/student/details?id=2", nil).Body.String(), "badge-secondary")
+}
@@ -0,0 +1,229 @@
+package gadm
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+)
+
+// Named query of list view, like flt0:stock+equals=2&sort=name&desc=1.
+// Filters and sort are stored by name, not by position, so changing
+// SetColumnFilters or the list columns later does not change the meaning.
+// Owned by user, or shared with everyone.
+type SavedView struct {
+	Id     int `gorm:"primaryKey"`
+	UserId int `gorm:"index;not null"`
+	// endpoint of model view
+	Endpoint string `gorm:"index;size:64;not null"`
+	Name     string `gorm:"size:64;not null"`
+	Query    string `gorm:"size:2048"`
+	Shared   bool
+	// opened by index of model without query
+	IsDefault bool
+	CreatedAt time.Time
+}
+
+// Url encoded state of list in form, without page and other args
+func viewQuery(uv url.Values) string {
+	vs := url.Values{}
+	for k, v := range uv {
+		if len(v) == 0 || v[0] == "" {
+			continue
+		}
+		if strings.HasPrefix(k, "flt") || lo.Contains([]string{"page_size", "sort", "desc", "search"}, k) {
+			vs.Set(k, v[0])
+		}
+	}
+	return vs.Encode()
+}
+
+// Stable name of filter, column or label with operation
+func filterName(f Filter) string {
+	name := f.Label()
+	if cf, ok := f.(*ColumnFilter); ok {
+		name = cf.column
+	}
+	return name + " " + f.Operation()
+}
+
+// Query of list to store, filters and sort by name
+func (V *ModelView) storedQuery(uv url.Values) string {
+	vs, _ := url.ParseQuery(viewQuery(uv))
+	for k, v := range vs {
+		switch {
+		case strings.HasPrefix(k, "flt"):
+			delete(vs, k)
+			if f := V.inputFilter(k, v[0]); f != nil {
+				n, _, _ := strings.Cut(k, "_")
+				vs.Set(n+":"+filterName(V.filters[f.Index]), v[0])
+			}
+		case k == "sort":
+			vs.Del(k)
+			if name := V.column_name(cast.ToInt(v[0])); name != "" {
+				vs.Set(k, name)
+			}
+		}
+	}
+	return vs.Encode()
+}
+
+// Stored query back to query of list, filters and sort no longer there are dropped
+func (V *ModelView) listQuery(stored string) string {
+	vs, _ := url.ParseQuery(stored)
+	for k, v := range vs {
+		switch {
+		case strings.HasPrefix(k, "flt"):
+			delete(vs, k)
+			n, name, _ := strings.Cut(k, ":")
+			if i := slices.IndexFunc(V.filters, func(f Filter) bool { return filterName(f) == name }); i != -1 {
+				vs.Set(fmt.Sprintf("%s_%d", n, i), v[0])
+			}
+		case k == "sort":
+			vs.Del(k)
+			if i := V.get_column_index(v[0]); i != -1 {
+				vs.Set(k, strconv.Itoa(i))
+			}
+		}
+	}
+	return vs.Encode()
+}
+
+// Saved views of model visible to user, private first then shared,
+// so private default wins over shared one
+func (V *ModelView) savedViews(r *http.Request) []SavedView {
+	S := V.admin.security
+	u := S.CurrentUser(r)
+	if u == nil || !S.Enabled() {
+		return nil
+	}
+	var vs []SavedView
+	S.db.Where("endpoint = ? AND (user_id = ? OR shared)", V.Blueprint.Endpoint, u.Id).
+		Order("name").Find(&vs)
+	slices.SortStableFunc(vs, func(a, b SavedView) int {
+		return cmp.Compare(lo.Ternary(a.Shared, 1, 0), lo.Ternary(b.Shared, 1, 0))
+	})
+	return vs
+}
+
+func (V *ModelView) savedViewUrl(sv *SavedView) string {
+	base := must(V.Blueprint.GetUrl(".index_view"))
+	query := V.listQuery(sv.Query)
+	if query == "" {
+		return base + "?all=1"
+	}
+	return base + "?" + query
+}
+
+// Quick links above the table, with url and whether it is current query
+func (V *ModelView) savedViewLinks(r *http.Request, vs []SavedView) []map[string]any {
+	u := V.admin.security.CurrentUser(r)
+	current := V.storedQuery(r.Form)
+	share := V.can(r, PermShare)
+	return lo.Map(vs, func(sv SavedView, _ int) map[string]any {
+		return map[string]any{
+			"id":          sv.Id,
+			"name":        sv.Name,
+			"url":         V.savedViewUrl(&sv),
+			"shared":      sv.Shared,
+			"default":     sv.IsDefault,
+			"own":         u != nil && sv.UserId == u.Id,
+			"active":      sv.Query == current,
+			"can_default": !sv.Shared || share,
+		}
+	})
+}
+
+// POST action: save with name, query, shared and default; delete or default of id
+func (V *ModelView) savedViewHandler(w http.ResponseWriter, r *http.Request) {
+	S := V.admin.security
+	u := S.CurrentUser(r)
+	if u == nil || !S.Enabled() || r.Method != http.MethodPost || !V.can(r, PermList) {
+		V.redirect(w, r)
+		return
+	}
+	r.ParseForm()
+
+	own := S.db.Where("endpoint = ? AND user_id = ?", V.Blueprint.Endpoint, u.Id).Session(&gorm.Session{})
+	action := r.PostFormValue("action")
+	var sv SavedView
+	if id := cast.ToInt(r.PostFormValue("id")); id != 0 || action != "save" {
+		if err := own.Take(&sv, id).Error; err != nil {
+			V.AddFlash(r, FlashDanger(gettext("Saved view does not exist.")))
+			V.redirect(w, r)
+			return
+		}
+	}
+
+	// shared views change the lists of everyone
+	if (sv.Shared || action == "save" && r.PostFormValue("shared") == "1") && action != "delete" && !V.can(r, PermShare) {
+		V.AddFlash(r, FlashDanger(gettext("Not allowed to share views.")))
+		V.redirect(w, r)
+		return
+	}
+
+	var err error
+	switch action {
+	case "delete":
+		err = S.db.Delete(&sv).Error
+		if err == nil {
+			V.AddFlash(r, FlashSuccess(gettext("Saved view was deleted.")))
+		}
+		V.redirect(w, r, must(V.Blueprint.GetUrl(".index_view", "all", 1)))
+		return
+	case "default":
+		err = V.setDefaultView(&sv, !sv.IsDefault)
+	case "save":
+		name := strings.TrimSpace(r.PostFormValue("name"))
+		if name == "" {
+			V.AddFlash(r, FlashDanger(gettext("Name of view is required.")))
+			V.redirect(w, r)
+			return
+		}
+		query, _ := url.ParseQuery(r.PostFormValue("query"))
+		// same name replaces own view
+		if sv.Id == 0 {
+			own.Where("name = ?", name).Take(&sv)
+		}
+		sv.UserId = u.Id
+		sv.Endpoint = V.Blueprint.Endpoint
+		sv.Name = name[:min(len(name), 64)]
+		sv.Query = V.storedQuery(query)
+		sv.Shared = r.PostFormValue("shared") == "1"
+		if err = S.db.Save(&sv).Error; err == nil {
+			err = V.setDefaultView(&sv, r.PostFormValue("default") == "1")
+		}
+		if err == nil {
+			V.AddFlash(r, FlashSuccess(gettext("View %s was saved.", sv.Name)))
+		}
+	}
+	if err != nil {
+		V.AddFlash(r, FlashError(err))
+	}
+	V.redirect(w, r, V.savedViewUrl(&sv))
+}
+
+// One private default of user for the model, and one among the shared views
+func (V *ModelView) setDefaultView(sv *SavedView, on bool) error {
+	return V.admin.security.db.Transaction(func(tx *gorm.DB) error {
+		if on {
+			others := tx.Model(&SavedView{}).Where("endpoint = ? AND id <> ? AND shared = ?", sv.Endpoint, sv.Id, sv.Shared)
+			if !sv.Shared {
+				others = others.Where("user_id = ?", sv.UserId)
+			}
+			if err := others.Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		sv.IsDefault = on
+		return tx.Model(sv).Update("is_default", on).Error
+	})
+}
@@ -0,0 +1,136 @@
+package gadm
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSavedViews(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Gadget{}, db).SetColumnFilters("stock"))
+	admin.freeze()
+	u, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	admin.Security().AddRoles(u, "admin")
+	admin.Security().CreateUser("bob@example.com", "secret")
+	db.Create(&Gadget{Name: "gear", Stock: 5})
+	db.Create(&Gadget{Name: "cog", Stock: 0})
+
+	alice := newTestClient(admin)
+	alice.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	bob := newTestClient(admin)
+	bob.post("/admin/login", "/admin/login", url.Values{"email": {"bob@example.com"}, "password": {"secret"}})
+
+	page := "/admin/gadget/?all=1"
+	body := alice.do("GET", "/admin/gadget/?flt0_2=1&sort=1&desc=1&page=1", nil).Body.String()
+	is.Contains(body, `name="query" value="desc=1&amp;flt0_2=1&amp;sort=1"`)
+
+	// saved without page and other args, redirected to it
+	w := alice.post(page, "/admin/gadget/saved_view", url.Values{"action": {"save"}, "name": {"In stock"},
+		"query": {"flt0_2=1&sort=1&desc=1&page=1&url=/x"}, "shared": {"1"}})
+	is.Equal(302, w.Code)
+	is.Equal("/admin/gadget/?desc=1&flt0_2=1&sort=1", w.Header().Get("Location"))
+	alice.post(page, "/admin/gadget/saved_view", url.Values{"action": {"save"}, "name": {"Mine"}, "query": {"search=cog"}})
+
+	body = alice.do("GET", "/admin/gadget/?desc=1&flt0_2=1&sort=1", nil).Body.String()
+	is.Contains(body, `href="/admin/gadget/?desc=1&amp;flt0_2=1&amp;sort=1">`)
+	is.Contains(body, `active" href="/admin/gadget/?desc=1&amp;flt0_2=1&amp;sort=1">`)
+	is.Contains(body, ">Mine</a>")
+	is.Contains(body, "Set as default")
+	is.Contains(body, "gear")
+	is.NotContains(body, "<td class=\"col-name\">cog")
+
+	// shared view is visible to others, but not owned
+	body = bob.do("GET", page, nil).Body.String()
+	is.Contains(body, "In stock")
+	is.NotContains(body, ">Mine</a>")
+	is.NotContains(body, "Set as default")
+
+	// sharing is for role admin
+	is.NotContains(body, `name="shared"`)
+	bob.post(page, "/admin/gadget/saved_view", url.Values{"action": {"save"}, "name": {"All mine"}, "query": {"sort=1"}, "shared": {"1"}, "default": {"1"}})
+	is.Contains(bob.do("GET", page, nil).Body.String(), "Not allowed to share views.")
+	var n int64
+	db.Model(&SavedView{}).Where("name = ?", "All mine").Count(&n)
+	is.Equal(int64(0), n)
+
+	var views []SavedView
+	db.Order("id").Find(&views)
+	is.Len(views, 2)
+	w = bob.post(page, "/admin/gadget/saved_view", url.Values{"action": {"delete"}, "id": {"1"}})
+	is.Equal(302, w.Code)
+	db.Model(&SavedView{}).Find(&views)
+	is.Len(views, 2)
+
+	// shared default, own default wins
+	alice.post(page, "/admin/gadget/saved_view", url.Values{"action": {"default"}, "id": {"1"}})
+	w = bob.do("GET", "/admin/gadget/", nil)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/gadget/?desc=1&flt0_2=1&sort=1", w.Header().Get("Location"))
+	is.Equal(200, bob.do("GET", page, nil).Code)
+
+	alice.post(page, "/admin/gadget/saved_view", url.Values{"action": {"default"}, "id": {"2"}})
+	is.Equal("/admin/gadget/?search=cog", alice.do("GET", "/admin/gadget/", nil).Header().Get("Location"))
+	is.Equal("/admin/gadget/?desc=1&flt0_2=1&sort=1", bob.do("GET", "/admin/gadget/", nil).Header().Get("Location"))
+
+	// save with same name replaces, one default of user
+	bob.post(page, "/admin/gadget/saved_view", url.Values{"action": {"save"}, "name": {"Bob"}, "query": {"sort=2"}, "default": {"1"}})
+	bob.post(page, "/admin/gadget/saved_view", url.Values{"action": {"save"}, "name": {"Bob"}, "query": {"sort=3"}, "default": {"1"}})
+	is.Equal("/admin/gadget/?sort=3", bob.do("GET", "/admin/gadget/", nil).Header().Get("Location"))
+	db.Model(&SavedView{}).Where("is_default").Count(&n)
+	is.Equal(int64(3), n)
+
+	alice.post(page, "/admin/gadget/saved_view", url.Values{"action": {"delete"}, "id": {"2"}})
+	is.Equal("/admin/gadget/?desc=1&flt0_2=1&sort=1", alice.do("GET", "/admin/gadget/", nil).Header().Get("Location"))
+	db.Model(&SavedView{}).Count(&n)
+	is.Equal(int64(2), n)
+}
+
+func TestSavedViewByName(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	mv := NewModelView(Gadget{}, db).SetColumnFilters("stock")
+	admin.AddView(mv)
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	c.post("/admin/gadget/?all=1", "/admin/gadget/saved_view", url.Values{"action": {"save"}, "name": {"Stock"},
+		"query": {"flt0_2=1&flt1_99=1&sort=2"}, "default": {"1"}})
+	var sv SavedView
+	db.Take(&sv)
+	is.NotContains(sv.Query, "flt0_2")
+	is.Contains(sv.Query, "sort=stock")
+	is.NotContains(sv.Query, "flt1")
+
+	// filters and columns changed later, same stock filter and sort
+	later := NewAdmin("Test Security")
+	later.trace = false
+	later.Security().SetDB(db)
+	gv := NewModelView(Gadget{}, db).SetColumnFilters("price", "stock").SetColumnList("price", "stock")
+	later.AddView(gv)
+	later.freeze()
+	i := slices.IndexFunc(gv.filters, func(f Filter) bool { return filterName(f) == filterName(mv.filters[2]) })
+	is.Greater(i, 2)
+
+	c = newTestClient(later)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	is.Equal(fmt.Sprintf("/admin/gadget/?flt0_%d=1&sort=1", i), c.do("GET", "/admin/gadget/", nil).Header().Get("Location"))
+
+	// filter removed, dropped instead of another one
+	last := NewAdmin("Test Security")
+	last.trace = false
+	last.Security().SetDB(db)
+	last.AddView(NewModelView(Gadget{}, db).SetColumnFilters("price"))
+	last.freeze()
+	c = newTestClient(last)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	is.Equal("/admin/gadget/?sort=2", c.do("GET", "/admin/gadget/", nil).Header().Get("Location"))
+}
@@ -1,19 +1,52 @@
 package gadm
 
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/csrf"
+	"golang.org/x/crypto/bcrypt"
 	"gopkg.in/guregu/null.v4"
+	"gorm.io/gorm"
 )
 
 type Security struct {
 	*BaseView
-	CurrentUser *BaseUser
+	db *gorm.DB
+
+	// endpoints can be visited without login, besides admin.static
+	public []string
+
+	// every user should enroll two-factor authentication
+	tf_required bool
+
+	// WebAuthn relying party, nil to use host of request
+	rp *relyingParty
+
+	mailer       Mailer
+	external_url string
+	registerable bool
+	confirmable  bool
+
+	// roles of self-registered users
+	default_roles []string
+
+	confirm_within time.Duration
+	reset_within   time.Duration
+
+	lockout      lockout
+	lockout_view *ModelView
 }
 
 func AddSecurity(admin *Admin) *Security {
-	S := new(Security)
+	S := &Security{lockout: defaultLockout}
 	S.BaseView = NewView(Menu{Name: gettext("Account"), Category: "Account"})
 	S.Blueprint = &Blueprint{
 		Endpoint: "security",
@@ -23,10 +56,27 @@ func AddSecurity(admin *Admin) *Security {
 			"register":          {Endpoint: "register", Path: "/register", Handler: S.registerHandler},
 			"forgot_password":   {Endpoint: "forgot_password", Path: "/forgot_password", Handler: S.forgotPasswordHandler},
 			"send_confirmation": {Endpoint: "send_confirmation", Path: "/send_confirmation", Handler: S.sendConfirmationHandler},
+			"confirm":           {Endpoint: "confirm", Path: "/confirm", Handler: S.confirmHandler},
+			"reset_password":    {Endpoint: "reset_password", Path: "/reset_password", Handler: S.resetPasswordHandler},
+			"tf_setup":          {Endpoint: "tf_setup", Path: "/tf_setup", Handler: S.tfSetupHandler},
+			"tf_validate":       {Endpoint: "tf_validate", Path: "/tf_validate", Handler: S.tfValidateHandler},
+
+			"wan_register":         {Endpoint: "wan_register", Path: "/wan_register", Handler: S.withWebAuthn(S.wanRegisterHandler)},
+			"wan_register_options": {Endpoint: "wan_register_options", Path: "/wan_register_options", Handler: S.withWebAuthn(S.wanRegisterOptionsHandler)},
+			"wan_delete":           {Endpoint: "wan_delete", Path: "/wan_delete", Handler: S.withWebAuthn(S.wanDeleteHandler)},
+			"api_tokens":           {Endpoint: "api_tokens", Path: "/api_tokens", Handler: S.apiTokensHandler},
+			"api_token_delete":     {Endpoint: "api_token_delete", Path: "/api_token_delete", Handler: S.apiTokenDeleteHandler},
+			"wan_signin":           {Endpoint: "wan_signin", Path: "/wan_signin", Handler: S.withWebAuthn(S.wanSigninHandler)},
+			"wan_signin_options":   {Endpoint: "wan_signin_options", Path: "/wan_signin_options", Handler: S.withWebAuthn(S.wanSigninOptionsHandler)},
 		},
 	}
+	S.public = []string{"admin.ping", "security.login", "security.tf_validate",
+		"security.wan_signin", "security.wan_signin_options",
+		"security.register", "security.send_confirmation", "security.confirm",
+		"security.forgot_password", "security.reset_password"}
 
 	admin.Register(S.Blueprint)
+	S.setAdmin(admin)
 
 	tm := &Menu{Name: "Theme", Category: "Theme"}
 	for _, name := range themes {
@@ -39,11 +89,287 @@ func AddSecurity(admin *Admin) *Security {
 	return S
 }
 
-func (S *Security) loginHandler(w http.ResponseWriter, r *http.Request)            {}
-func (S *Security) logoutHandler(w http.ResponseWriter, r *http.Request)           {}
-func (S *Security) registerHandler(w http.ResponseWriter, r *http.Request)         {}
-func (S *Security) forgotPasswordHandler(w http.ResponseWriter, r *http.Request)   {}
-func (S *Security) sendConfirmationHandler(w http.ResponseWriter, r *http.Request) {}
+// Store users in db, and require login for all views.
+// Without db the admin is open to everyone.
+func (S *Security) SetDB(db *gorm.DB) *Security {
+	S.db = db
+
+	if S.admin.autoMigrate {
+		if err := db.AutoMigrate(&BaseUser{}, &Role{}, &WebAuthnCredential{}, &LoginLockout{}, &ApiToken{}, &SavedView{}); err != nil {
+			panic(err)
+		}
+	}
+
+	S.lockout_view = NewModelView(LoginLockout{}, db, "Security").
+		SetCanCreate(false).
+		SetCanEdit(false).
+		SetColumnFilters("kind", "identity")
+	S.lockout_view.SetAccessRoles("admin")
+	S.admin.AddView(S.lockout_view)
+
+	S.Menu.AddMenu(&Menu{Name: gettext("Two-factor authentication"),
+		Path: must(S.Blueprint.GetUrl("security.tf_setup"))}, "Account")
+	S.Menu.AddMenu(&Menu{Name: gettext("API tokens"),
+		Path: must(S.Blueprint.GetUrl("security.api_tokens"))}, "Account")
+	S.Menu.AddMenu(&Menu{Name: gettext("Log out"), Method: http.MethodPost,
+		Path: must(S.Blueprint.GetUrl("security.logout"))}, "Account")
+	return S
+}
+
+func (S *Security) Enabled() bool { return S.db != nil }
+
+// Users without two-factor authentication must enroll before anything else
+func (S *Security) SetTwoFactorRequired(v bool) *Security {
+	S.tf_required = v
+	return S
+}
+
+// Create an active user with hashed password
+func (S *Security) CreateUser(email, password string) (*BaseUser, error) {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	u := &BaseUser{
+		Email:          email,
+		Password:       hash,
+		Active:         true,
+		Uniquifier:     uuid.NewString(),
+		CreateDatetime: now,
+		UpdateDatetime: now,
+	}
+	if err := S.db.Create(u).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Change password, all sessions of the user are invalid after this
+func (S *Security) SetPassword(u *BaseUser, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return S.db.Model(u).Updates(map[string]any{
+		"password":        hash,
+		"uniquifier":      uuid.NewString(),
+		"update_datetime": time.Now(),
+	}).Error
+}
+
+type userKey struct{}
+
+// Logged in user of the request, nil for anonymous
+func (S *Security) CurrentUser(r *http.Request) *BaseUser {
+	u, _ := r.Context().Value(userKey{}).(*BaseUser)
+	return u
+}
+
+// Load user from session into request context
+func (S *Security) authenticate(r *http.Request) *http.Request {
+	if !S.Enabled() {
+		return r
+	}
+
+	sess := S.admin.Session(r)
+	id, ok := sess.Values["user_id"].(int)
+	if !ok {
+		return r
+	}
+
+	var u BaseUser
+	if err := S.db.Preload("Roles").First(&u, id).Error; err != nil ||
+		!u.Active || u.Uniquifier != sess.Values["fs_uniquifier"] {
+		delete(sess.Values, "user_id")
+		delete(sess.Values, "fs_uniquifier")
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, &u))
+}
+
+// Current user has one of roles. Always true without roles or security.
+func (S *Security) HasRole(r *http.Request, roles ...string) bool {
+	if !S.Enabled() || len(roles) == 0 {
+		return true
+	}
+	if u := S.CurrentUser(r); u != nil {
+		return u.HasRole(roles...)
+	}
+	return false
+}
+
+// Grant roles to user, create the missing roles
+func (S *Security) AddRoles(u *BaseUser, names ...string) error {
+	return S.db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			role := Role{Name: name}
+			if err := tx.Where(role).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(u).Association("Roles").Append(&role); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (S *Security) isPublic(path string) bool {
+	return slices.ContainsFunc(S.public, func(ep string) bool {
+		return must(S.Blueprint.GetUrl(ep)) == path
+	})
+}
+
+// Redirect anonymous request to `security.login`
+func (S *Security) protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !S.Enabled() || S.isPublic(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u := S.CurrentUser(r)
+		if u == nil && isApiPath(r.URL.Path) {
+			replyError(w, http.StatusUnauthorized, errors.New(gettext("Please log in to access this page.")))
+			return
+		}
+		if u == nil {
+			http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login",
+				"next", r.URL.RequestURI())), http.StatusFound)
+			return
+		}
+
+		if S.tf_required && u.TfPrimaryMethod == "" && apiTokenOf(r) == nil &&
+			!slices.Contains([]string{
+				must(S.Blueprint.GetUrl("security.tf_setup")),
+				must(S.Blueprint.GetUrl("security.logout")),
+			}, r.URL.Path) {
+			http.Redirect(w, r, must(S.Blueprint.GetUrl("security.tf_setup")), http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (S *Security) login(r *http.Request, u *BaseUser) {
+	if err := S.track(r, u); err != nil {
+		log.Printf("track login of %s failed: %s", u.Email, err)
+	}
+	S.resetLockout(u)
+
+	sess := S.admin.Session(r)
+	sess.Values["user_id"] = u.Id
+	sess.Values["fs_uniquifier"] = u.Uniquifier
+}
+
+func (S *Security) logout(r *http.Request) {
+	sess := S.admin.Session(r)
+	delete(sess.Values, "user_id")
+	delete(sess.Values, "fs_uniquifier")
+}
+
+// Find user by email or username, and verify password
+func (S *Security) check(identity, password string) (*BaseUser, error) {
+	var u BaseUser
+	if err := S.db.Where("email = ? OR username = ?", identity, identity).
+		First(&u).Error; err != nil {
+		// same cost as a wrong password
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyHash()), []byte(password))
+		return nil, errors.New(gettext("Invalid username or password"))
+	}
+	if !u.VerifyPassword(password) {
+		return nil, errors.New(gettext("Invalid username or password"))
+	}
+	if !u.Active {
+		return nil, errors.New(gettext("Account is disabled"))
+	}
+	if S.confirmable && !u.ConfirmedAt.Valid {
+		return nil, errors.New(gettext("Email requires confirmation."))
+	}
+	return &u, nil
+}
+
+// Only local path is allowed, avoid open redirect
+func safeNext(next, or string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") ||
+		strings.HasPrefix(next, "/\\") {
+		return or
+	}
+	return next
+}
+
+func (S *Security) loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.FormValue("next"), must(S.Blueprint.GetUrl("admin.index")))
+	if !S.Enabled() || S.CurrentUser(r) != nil {
+		http.Redirect(w, r, next, http.StatusFound)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodPost {
+		var u *BaseUser
+		status := http.StatusUnauthorized
+		identity, ip := r.PostFormValue("email"), clientIp(r)
+		if err = S.checkLockout(identity, ip); err != nil {
+			status = http.StatusTooManyRequests
+		} else if u, err = S.check(identity, r.PostFormValue("password")); err == nil {
+			if u.TfPrimaryMethod == tfAuthenticator {
+				S.beginTwoFactor(r, u)
+				http.Redirect(w, r, must(S.Blueprint.GetUrl("security.tf_validate", "next", next)), http.StatusFound)
+				return
+			}
+			S.login(r, u)
+			http.Redirect(w, r, next, http.StatusFound)
+			return
+		} else {
+			S.failLogin(identity, ip)
+		}
+		w.WriteHeader(status)
+	}
+
+	S.Render(w, r, "templates/login.gotmpl", nil, map[string]any{
+		"name":       gettext("Log in"),
+		"email":      r.PostFormValue("email"),
+		"next":       next,
+		"error":      err,
+		"csrf_field": csrf.TemplateField(r),
+		"csrf_token": csrf.Token(r),
+
+		"registerable":          S.registerable,
+		"confirmable":           S.confirmable,
+		"register_url":          must(S.Blueprint.GetUrl("security.register")),
+		"forgot_password_url":   must(S.Blueprint.GetUrl("security.forgot_password")),
+		"send_confirmation_url": must(S.Blueprint.GetUrl("security.send_confirmation")),
+
+		"wan_enabled":     S.rp != nil,
+		"wan_options_url": must(S.Blueprint.GetUrl("security.wan_signin_options")),
+		"wan_signin_url":  must(S.Blueprint.GetUrl("security.wan_signin")),
+	})
+}
+
+// POST only with csrf token, a cross-site link can not log out
+func (S *Security) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	S.logout(r)
+	http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+}
+
+// bcrypt hash for password
+func HashPassword(password string) (string, error) {
+	bs, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(bs), err
+}
+
+// compare with when user not found, keep response time similar
+var dummyHash = sync.OnceValue(func() string {
+	return must(HashPassword("gadm"))
+})
 
 type BaseUser struct {
 	Id    int    `gorm:"primaryKey"`
@@ -72,5 +398,36 @@ type BaseUser struct {
 	// 2FA
 	TfPrimaryMethod string `gorm:"size:64"`
 	TfTotpSecret    string `gorm:"size:255"`
-	TfPhoneNumber   string `gorm:"size:128"`
+	// time step of the last accepted code, against replay
+	TfTotpLastStep int64
+	TfPhoneNumber  string `gorm:"size:128"`
+	// sha256 of unused recovery codes, comma separated
+	TfRecoveryCodes string `gorm:"size:1024"`
+
+	// WebAuthn user.id of passkeys
+	WebAuthnUserHandle string `gorm:"index;size:64"`
+
+	Roles []Role `gorm:"many2many:base_user_role"`
+}
+
+type Role struct {
+	Id          int    `gorm:"primaryKey"`
+	Name        string `gorm:"uniqueIndex;not null;size:80"`
+	Description string `gorm:"size:255"`
+}
+
+func (r *Role) String() string { return r.Name }
+
+func (u *BaseUser) VerifyPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// Display in menu
+func (u *BaseUser) String() string { return emptyOr(u.Username, u.Email) }
+
+// User has one of roles
+func (u *BaseUser) HasRole(names ...string) bool {
+	return slices.ContainsFunc(u.Roles, func(r Role) bool {
+		return slices.Contains(names, r.Name)
+	})
 }
@@ -0,0 +1,190 @@
+package gadm
+
+import (
+	"gadm/examples/sqla"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// browser liked, keep cookies between requests
+type testClient struct {
+	h       http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func newTestClient(h http.Handler) *testClient {
+	return &testClient{h: h, cookies: map[string]*http.Cookie{}}
+}
+
+func (c *testClient) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	var r *http.Request
+	if form != nil {
+		r = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		r.Header.Set("content-type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, path, nil)
+	}
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, r)
+	for _, ck := range w.Result().Cookies() {
+		c.cookies[ck.Name] = ck
+	}
+	return w
+}
+
+var csrfPattern = regexp.MustCompile(`name="csrf_token"[^>]* value="([^"]+)"`)
+
+// GET path, post form with csrf_token in the page
+func (c *testClient) post(page, path string, form url.Values) *httptest.ResponseRecorder {
+	w := c.do("GET", page, nil)
+	if m := csrfPattern.FindStringSubmatch(w.Body.String()); m != nil {
+		form.Set("csrf_token", html.UnescapeString(m[1]))
+	}
+	return c.do("POST", path, form)
+}
+
+func newSecureAdmin(t *testing.T) (*Admin, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{NamingStrategy: Namer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := NewAdmin("Test Security")
+	admin.trace = false
+	admin.Security().SetDB(db)
+	return admin, db
+}
+
+func TestPassword(t *testing.T) {
+	is := assert.New(t)
+
+	hash, err := HashPassword("secret")
+	is.Nil(err)
+	is.NotEqual("secret", hash)
+
+	u := BaseUser{Password: hash}
+	is.True(u.VerifyPassword("secret"))
+	is.False(u.VerifyPassword("Secret"))
+
+	is.Equal("/admin/", safeNext("", "/admin/"))
+	is.Equal("/admin/", safeNext("//evil.com", "/admin/"))
+	is.Equal("/admin/", safeNext("https://evil.com", "/admin/"))
+	is.Equal("/admin/user/", safeNext("/admin/user/", "/admin/"))
+}
+
+func TestLogin(t *testing.T) {
+	is := assert.New(t)
+
+	admin, _ := newSecureAdmin(t)
+	u, err := admin.Security().CreateUser("alice@example.com", "secret")
+	is.Nil(err)
+	is.NotEmpty(u.Uniquifier)
+
+	c := newTestClient(admin)
+
+	// anonymous
+	w := c.do("GET", "/admin/", nil)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/login?next=%2Fadmin%2F", w.Header().Get("location"))
+	is.Equal(200, c.do("GET", "/admin/ping", nil).Code)
+	is.Equal(200, c.do("GET", "/admin/login", nil).Code)
+
+	// wrong password
+	w = c.post("/admin/login", "/admin/login", url.Values{
+		"email": {"alice@example.com"}, "password": {"wrong"}})
+	is.Equal(401, w.Code)
+	is.Equal(302, c.do("GET", "/admin/", nil).Code)
+
+	w = c.post("/admin/login", "/admin/login", url.Values{
+		"email": {"alice@example.com"}, "password": {"secret"}, "next": {"/admin/trace"}})
+	is.Equal(302, w.Code)
+	is.Equal("/admin/trace", w.Header().Get("location"))
+	is.Equal(200, c.do("GET", "/admin/", nil).Code)
+
+	// password changed, session is invalid
+	is.Nil(admin.Security().SetPassword(u, "secret2"))
+	is.Equal(302, c.do("GET", "/admin/", nil).Code)
+
+	w = c.post("/admin/login", "/admin/login", url.Values{
+		"email": {"alice@example.com"}, "password": {"secret2"}})
+	is.Equal(302, w.Code)
+	is.Equal("/admin/", w.Header().Get("location"))
+	is.Equal(200, c.do("GET", "/admin/", nil).Code)
+
+	// not by a cross-site link or form
+	is.Equal(405, c.do("GET", "/admin/logout", nil).Code)
+	is.Equal(403, c.do("POST", "/admin/logout", nil).Code)
+	is.Equal(200, c.do("GET", "/admin/", nil).Code)
+
+	w = c.do("GET", "/admin/", nil)
+	is.Contains(w.Body.String(), `<form method="POST" action="/admin/logout">`)
+	w = c.post("/admin/", "/admin/logout", url.Values{})
+	is.Equal(302, w.Code)
+	is.Equal(302, c.do("GET", "/admin/", nil).Code)
+}
+
+func TestRoles(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&sqla.Company{})
+
+	vc := NewModelView(sqla.Company{}, db, "Association").
+		SetRequiredRoles(PermList, "staff").
+		SetRequiredRoles(PermDelete, "manager")
+	admin.AddView(vc)
+	rv := NewView(Menu{Name: "Report", Category: "Other"})
+	rv.Blueprint = &Blueprint{Endpoint: "report", Path: "/report"}
+	rv.Expose("/", func(w http.ResponseWriter, r *http.Request) {})
+	admin.AddView(rv.SetAccessRoles("manager"))
+
+	alice, _ := admin.Security().CreateUser("alice@example.com", "secret")
+	is.Nil(admin.Security().AddRoles(alice, "staff"))
+	bob, _ := admin.Security().CreateUser("bob@example.com", "secret")
+	is.Nil(admin.Security().AddRoles(bob, "staff", "manager"))
+	admin.Security().CreateUser("carol@example.com", "secret")
+
+	login := func(email string) *testClient {
+		c := newTestClient(admin)
+		w := c.post("/admin/login", "/admin/login", url.Values{
+			"email": {email}, "password": {"secret"}})
+		is.Equal(302, w.Code)
+		return c
+	}
+
+	ca := login("alice@example.com")
+	is.Equal(200, ca.do("GET", "/admin/company/", nil).Code)
+	w := ca.do("GET", "/admin/", nil)
+	is.Contains(w.Body.String(), `href="/admin/company/"`)
+	is.NotContains(w.Body.String(), "Report")
+	// delete is not allowed
+	w = ca.post("/admin/company/new", "/admin/company/delete", url.Values{"id": {"1"}})
+	is.Equal(302, w.Code)
+
+	cb := login("bob@example.com")
+	w = cb.do("GET", "/admin/", nil)
+	is.Contains(w.Body.String(), `href="/admin/company/"`)
+	is.Contains(w.Body.String(), "Report")
+	is.Equal(200, cb.do("GET", "/admin/report/", nil).Code)
+	is.Equal(403, ca.do("GET", "/admin/report/", nil).Code)
+
+	cc := login("carol@example.com")
+	is.Equal(403, cc.do("GET", "/admin/company/", nil).Code)
+	is.Equal(403, cc.do("GET", "/admin/company/new", nil).Code)
+	w = cc.do("GET", "/admin/", nil)
+	is.Equal(200, w.Code)
+	is.NotContains(w.Body.String(), `href="/admin/company/"`)
+	is.NotContains(w.Body.String(), "Association")
+}
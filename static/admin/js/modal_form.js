@@ -0,0 +1,42 @@
+// Post forms in the modal window by ajax.
+// 204 means saved: close the modal and refresh the list,
+// otherwise the response is the form with errors.
+(function ($) {
+  function refreshList() {
+    $.get(window.location.href, function (html) {
+      var $page = $('<div>').append($.parseHTML(html));
+      $('.table-responsive').replaceWith($page.find('.table-responsive'));
+      $('.pagination').replaceWith($page.find('.pagination'));
+      $('.nav-tabs .nav-link.active').first().replaceWith($page.find('.nav-tabs .nav-link.active').first());
+      $('.container-fluid > .alert').remove();
+      $page.find('.alert').insertAfter('nav.navbar');
+      window.faForm.applyGlobalStyles($('.table-responsive')[0]);
+    });
+  }
+
+  $('body').on('submit', '.modal form.admin-form', function (e) {
+    e.preventDefault();
+    var form = this;
+    var $content = $(form).closest('.modal-content');
+    $.ajax({
+      url: form.action,
+      type: 'POST',
+      data: new FormData(form),
+      processData: false,
+      contentType: false,
+      success: function (html, status, xhr) {
+        if (xhr.status === 204) {
+          $content.closest('.modal').modal('hide');
+          refreshList();
+        } else {
+          // scripts in the form apply styles
+          $content.html(html);
+        }
+      },
+      error: function (xhr) {
+        $content.find('.modal-body').prepend(
+          $('<div class="alert alert-danger">').text(xhr.responseText || xhr.statusText));
+      }
+    });
+  });
+})(jQuery);
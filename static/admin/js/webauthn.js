@@ -0,0 +1,88 @@
+(function() {
+    // base64url <-> ArrayBuffer
+    function decode(s) {
+        s = s.replace(/-/g, '+').replace(/_/g, '/');
+        while (s.length % 4) s += '=';
+        return Uint8Array.from(atob(s), function(c) { return c.charCodeAt(0); }).buffer;
+    }
+
+    function encode(buf) {
+        var s = String.fromCharCode.apply(null, new Uint8Array(buf));
+        return btoa(s).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+    }
+
+    function post(url, token, body) {
+        return fetch(url, {
+            method: 'POST',
+            credentials: 'same-origin',
+            headers: {'Content-Type': 'application/json', 'X-CSRF-Token': token},
+            body: body ? JSON.stringify(body) : null
+        }).then(function(resp) {
+            return resp.json().then(function(data) {
+                if (!resp.ok) throw new Error(data.error || resp.statusText);
+                return data;
+            });
+        });
+    }
+
+    function credential(c) {
+        var r = c.response, o = {id: c.id, rawId: encode(c.rawId), type: c.type, response: {
+            clientDataJSON: encode(r.clientDataJSON)
+        }};
+        if (r.attestationObject) o.response.attestationObject = encode(r.attestationObject);
+        if (r.authenticatorData) o.response.authenticatorData = encode(r.authenticatorData);
+        if (r.signature) o.response.signature = encode(r.signature);
+        if (r.userHandle) o.response.userHandle = encode(r.userHandle);
+        return o;
+    }
+
+    function fail(el, err) {
+        var msg = document.querySelector(el.dataset.error);
+        if (msg) {
+            msg.textContent = err.message;
+            msg.classList.remove('d-none');
+        }
+    }
+
+    // <button data-webauthn="register" data-options="" data-finish="" data-token="" data-name="#input">
+    function register(el) {
+        var name = document.querySelector(el.dataset.name);
+        post(el.dataset.options, el.dataset.token).then(function(data) {
+            var pk = data.publicKey;
+            pk.challenge = decode(pk.challenge);
+            pk.user.id = decode(pk.user.id);
+            pk.excludeCredentials.forEach(function(c) { c.id = decode(c.id); });
+            return navigator.credentials.create({publicKey: pk});
+        }).then(function(c) {
+            var url = el.dataset.finish + '?name=' + encodeURIComponent(name ? name.value : '');
+            return post(url, el.dataset.token, credential(c));
+        }).then(function(data) {
+            window.location = data.location;
+        }).catch(function(err) { fail(el, err); });
+    }
+
+    // <button data-webauthn="signin" data-options="" data-finish="" data-token="">
+    function signin(el) {
+        post(el.dataset.options, el.dataset.token).then(function(data) {
+            var pk = data.publicKey;
+            pk.challenge = decode(pk.challenge);
+            pk.allowCredentials.forEach(function(c) { c.id = decode(c.id); });
+            return navigator.credentials.get({publicKey: pk});
+        }).then(function(c) {
+            return post(el.dataset.finish, el.dataset.token, credential(c));
+        }).then(function(data) {
+            window.location = data.location;
+        }).catch(function(err) { fail(el, err); });
+    }
+
+    document.querySelectorAll('[data-webauthn]').forEach(function(el) {
+        if (!window.PublicKeyCredential) {
+            el.disabled = true;
+            return;
+        }
+        el.addEventListener('click', function(e) {
+            e.preventDefault();
+            (el.dataset.webauthn === 'register' ? register : signin)(el);
+        });
+    });
+})();
@@ -0,0 +1,315 @@
+package gadm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/skip2/go-qrcode"
+)
+
+// BaseUser.TfPrimaryMethod of TOTP, same as Flask-Security
+const tfAuthenticator = "authenticator"
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// accepted clock skew, in periods
+	totpSkew = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Random 160 bits secret in base32, as RFC 4226 recommended
+func NewTotpSecret() string {
+	bs := make([]byte, 20)
+	if _, err := rand.Read(bs); err != nil {
+		panic(err)
+	}
+	return b32.EncodeToString(bs)
+}
+
+// RFC 6238 code of HMAC-SHA1 at time t
+func TotpCode(secret string, t time.Time) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix()/totpPeriod)), nil
+}
+
+// RFC 4226
+func hotp(key []byte, counter uint64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, code%mod)
+}
+
+// Check code at time t, allow previous and next period
+func ValidateTotp(secret, code string, t time.Time) bool {
+	_, ok := totpStep(secret, code, t)
+	return ok
+}
+
+// Time step of the matched code
+func totpStep(secret, code string, t time.Time) (int64, bool) {
+	if secret == "" || len(code) != totpDigits {
+		return 0, false
+	}
+	for i := -totpSkew; i <= totpSkew; i++ {
+		at := t.Add(time.Duration(i*totpPeriod) * time.Second)
+		expect, err := TotpCode(secret, at)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// Code of user can be used only once, RFC 6238 section 5.2.
+// Steps not after the last accepted one are rejected.
+func (S *Security) useTotp(u *BaseUser, code string) bool {
+	step, ok := totpStep(u.TfTotpSecret, code, time.Now())
+	if !ok || step <= u.TfTotpLastStep {
+		return false
+	}
+	rc := S.db.Model(&BaseUser{}).Where("id = ? AND tf_totp_last_step < ?", u.Id, step).
+		Update("tf_totp_last_step", step)
+	if rc.Error != nil || rc.RowsAffected != 1 {
+		return false
+	}
+	u.TfTotpLastStep = step
+	return true
+}
+
+// otpauth://totp/{issuer}:{account}?secret=...&issuer=...
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func totpURI(issuer, account, secret string) string {
+	uv := url.Values{}
+	uv.Set("secret", secret)
+	uv.Set("issuer", issuer)
+	uv.Set("algorithm", "SHA1")
+	uv.Set("digits", fmt.Sprint(totpDigits))
+	uv.Set("period", fmt.Sprint(totpPeriod))
+
+	u := url.URL{Scheme: "otpauth", Host: "totp",
+		Path: "/" + issuer + ":" + account, RawQuery: uv.Encode()}
+	return u.String()
+}
+
+// QR code png as data url, for <img src="">
+func qrcodeDataURL(content string) (template.URL, error) {
+	png, err := qrcode.Encode(content, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+// Generate recovery codes like: 7kq2m-x4fpa
+// Return codes to show once, and hashes to save
+func newRecoveryCodes(n int) ([]string, string) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		bs := make([]byte, 7)
+		if _, err := rand.Read(bs); err != nil {
+			panic(err)
+		}
+		s := strings.ToLower(b32.EncodeToString(bs))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, strings.Join(hashes, ",")
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Recovery code can be used only once, even by concurrent logins
+func (S *Security) useRecoveryCode(u *BaseUser, code string) bool {
+	if u.TfRecoveryCodes == "" || code == "" {
+		return false
+	}
+
+	hashes := strings.Split(u.TfRecoveryCodes, ",")
+	i := slices.Index(hashes, hashRecoveryCode(code))
+	if i == -1 {
+		return false
+	}
+
+	rest := strings.Join(slices.Delete(hashes, i, i+1), ",")
+	rc := S.db.Model(&BaseUser{}).Where("id = ? AND tf_recovery_codes = ?", u.Id, u.TfRecoveryCodes).
+		Update("tf_recovery_codes", rest)
+	if rc.Error != nil || rc.RowsAffected != 1 {
+		return false
+	}
+	u.TfRecoveryCodes = rest
+	return true
+}
+
+// Password is correct, wait for the second step
+func (S *Security) beginTwoFactor(r *http.Request, u *BaseUser) {
+	sess := S.admin.Session(r)
+	sess.Values["tf_user_id"] = u.Id
+	sess.Values["tf_uniquifier"] = u.Uniquifier
+}
+
+func (S *Security) endTwoFactor(r *http.Request) {
+	sess := S.admin.Session(r)
+	delete(sess.Values, "tf_user_id")
+	delete(sess.Values, "tf_uniquifier")
+}
+
+// Second step of login, verify the code from authenticator app or a recovery code
+func (S *Security) tfValidateHandler(w http.ResponseWriter, r *http.Request) {
+	next := safeNext(r.FormValue("next"), must(S.Blueprint.GetUrl("admin.index")))
+	login := must(S.Blueprint.GetUrl("security.login", "next", next))
+
+	sess := S.admin.Session(r)
+	id, ok := sess.Values["tf_user_id"].(int)
+	if !S.Enabled() || !ok {
+		http.Redirect(w, r, login, http.StatusFound)
+		return
+	}
+
+	var u BaseUser
+	if err := S.db.First(&u, id).Error; err != nil ||
+		!u.Active || u.Uniquifier != sess.Values["tf_uniquifier"] {
+		S.endTwoFactor(r)
+		http.Redirect(w, r, login, http.StatusFound)
+		return
+	}
+
+	var err error
+	if r.Method == http.MethodPost {
+		code := strings.TrimSpace(r.PostFormValue("code"))
+		ip := clientIp(r)
+		if err = S.checkLockout(u.Email, ip); err != nil {
+			w.WriteHeader(http.StatusTooManyRequests)
+		} else if S.useTotp(&u, code) || S.useRecoveryCode(&u, code) {
+			S.endTwoFactor(r)
+			S.login(r, &u)
+			http.Redirect(w, r, next, http.StatusFound)
+			return
+		} else {
+			S.failLogin(u.Email, ip)
+			err = errors.New(gettext("Invalid code"))
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}
+
+	S.Render(w, r, "templates/tf_validate.gotmpl", nil, map[string]any{
+		"name":       gettext("Two-factor authentication"),
+		"next":       next,
+		"error":      err,
+		"csrf_field": csrf.TemplateField(r),
+	})
+}
+
+// Enroll authenticator app, regenerate recovery codes, or disable 2FA
+func (S *Security) tfSetupHandler(w http.ResponseWriter, r *http.Request) {
+	u := S.CurrentUser(r)
+	if u == nil {
+		http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+		return
+	}
+
+	sess := S.admin.Session(r)
+	secret, _ := sess.Values["tf_totp_secret"].(string)
+
+	var err error
+	var codes []string
+	if r.Method == http.MethodPost {
+		code := strings.TrimSpace(r.PostFormValue("code"))
+		action := r.PostFormValue("action")
+		enrolled := u.TfPrimaryMethod == tfAuthenticator
+
+		step, valid := totpStep(secret, code, time.Now())
+		switch {
+		// replacing the authenticator requires the code of current one
+		case action == "setup" && valid && (!enrolled || S.useTotp(u, r.PostFormValue("code_current"))):
+			var hashes string
+			codes, hashes = newRecoveryCodes(10)
+			err = S.db.Model(u).Updates(map[string]any{
+				"tf_primary_method": tfAuthenticator,
+				"tf_totp_secret":    secret,
+				"tf_recovery_codes": hashes,
+				"tf_totp_last_step": step,
+			}).Error
+			delete(sess.Values, "tf_totp_secret")
+		case action == "recovery_codes" && enrolled && S.useTotp(u, code):
+			var hashes string
+			codes, hashes = newRecoveryCodes(10)
+			err = S.db.Model(u).Update("tf_recovery_codes", hashes).Error
+		case action == "disable" && enrolled && !S.tf_required && S.useTotp(u, code):
+			err = S.db.Model(u).Updates(map[string]any{
+				"tf_primary_method": "",
+				"tf_totp_secret":    "",
+				"tf_recovery_codes": "",
+			}).Error
+			if err == nil {
+				S.AddFlash(r, FlashSuccess(gettext("Two-factor authentication is disabled")))
+			}
+		default:
+			err = errors.New(gettext("Invalid code"))
+		}
+
+		if err == nil && len(codes) == 0 {
+			http.Redirect(w, r, must(S.Blueprint.GetUrl("security.tf_setup")), http.StatusFound)
+			return
+		}
+	}
+
+	// a new secret for each enrollment
+	if r.Method == http.MethodGet || secret == "" {
+		secret = NewTotpSecret()
+		sess.Values["tf_totp_secret"] = secret
+	}
+	uri := totpURI(S.admin.Blueprint.Name, u.Email, secret)
+
+	S.Render(w, r, "templates/tf_setup.gotmpl", nil, map[string]any{
+		"name":           gettext("Two-factor authentication"),
+		"enrolled":       u.TfPrimaryMethod == tfAuthenticator || len(codes) > 0,
+		"required":       S.tf_required,
+		"secret":         secret,
+		"uri":            uri,
+		"qrcode":         must(qrcodeDataURL(uri)),
+		"recovery_codes": codes,
+		"error":          err,
+		"csrf_field":     csrf.TemplateField(r),
+	})
+}
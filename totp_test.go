@@ -0,0 +1,171 @@
+package gadm
+
+import (
+	"html"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTotp(t *testing.T) {
+	is := assert.New(t)
+
+	// RFC 6238 Appendix B, SHA1, last 6 digits
+	secret := b32.EncodeToString([]byte("12345678901234567890"))
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, expect := range cases {
+		code, err := TotpCode(secret, time.Unix(ts, 0))
+		is.Nil(err)
+		is.Equal(expect, code)
+	}
+
+	now := time.Unix(1234567890, 0)
+	is.True(ValidateTotp(secret, "005924", now))
+	is.True(ValidateTotp(secret, "005924", now.Add(30*time.Second)))
+	is.False(ValidateTotp(secret, "005924", now.Add(90*time.Second)))
+	is.False(ValidateTotp(secret, "", now))
+	is.False(ValidateTotp("", "005924", now))
+
+	is.Len(NewTotpSecret(), 32)
+	is.Equal("otpauth://totp/Admin:alice@example.com?algorithm=SHA1&digits=6&issuer=Admin&period=30&secret=ABC",
+		totpURI("Admin", "alice@example.com", "ABC"))
+
+	codes, hashes := newRecoveryCodes(3)
+	is.Len(codes, 3)
+	is.Regexp(`^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+	is.Contains(hashes, hashRecoveryCode(codes[1]))
+	is.Equal(hashRecoveryCode(codes[1]), hashRecoveryCode(" "+codes[1][:5]+codes[1][6:]))
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Security().CreateUser("alice@example.com", "secret")
+	login := url.Values{"email": {"alice@example.com"}, "password": {"secret"}}
+
+	c := newTestClient(admin)
+	is.Equal(302, c.post("/admin/login", "/admin/login", login).Code)
+
+	// enroll
+	w := c.do("GET", "/admin/tf_setup", nil)
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "data:image/png;base64,")
+	w = c.post("/admin/tf_setup", "/admin/tf_setup", url.Values{"action": {"setup"}, "code": {"000000"}})
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "Invalid code")
+
+	// same secret after failed
+	secret := regexp.MustCompile(`<code>([A-Z2-7]+)</code>`).FindStringSubmatch(w.Body.String())[1]
+
+	code, _ := TotpCode(secret, time.Now())
+	w = c.do("POST", "/admin/tf_setup", url.Values{"action": {"setup"}, "code": {code},
+		"csrf_token": {html.UnescapeString(csrfPattern.FindStringSubmatch(w.Body.String())[1])}})
+	is.Equal(200, w.Code)
+	pre := regexp.MustCompile(`(?s)<pre class="recovery-codes">(.*)</pre>`).FindStringSubmatch(w.Body.String())
+	recovery := regexp.MustCompile(`[a-z2-7]{5}-[a-z2-7]{5}`).FindAllString(pre[1], -1)
+	is.Len(recovery, 10)
+
+	// second step
+	c.post("/admin/", "/admin/logout", url.Values{})
+	w = c.post("/admin/login", "/admin/login", login)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/tf_validate?next=%2Fadmin%2F", w.Header().Get("location"))
+	is.Equal(302, c.do("GET", "/admin/", nil).Code)
+
+	w = c.post("/admin/tf_validate", "/admin/tf_validate", url.Values{"code": {"000000"}})
+	is.Equal(401, w.Code)
+	// used in setup
+	is.Equal(401, c.post("/admin/tf_validate", "/admin/tf_validate", url.Values{"code": {code}}).Code)
+	next, _ := TotpCode(secret, time.Now().Add(totpPeriod*time.Second))
+	w = c.post("/admin/tf_validate", "/admin/tf_validate", url.Values{"code": {next}})
+	is.Equal(302, w.Code)
+	is.Equal(200, c.do("GET", "/admin/", nil).Code)
+
+	// code only once, and not the earlier ones
+	c.post("/admin/", "/admin/logout", url.Values{})
+	c.post("/admin/login", "/admin/login", login)
+	is.Equal(401, c.post("/admin/tf_validate", "/admin/tf_validate", url.Values{"code": {next}}).Code)
+	prev, _ := TotpCode(secret, time.Now().Add(-totpPeriod*time.Second))
+	is.Equal(401, c.post("/admin/tf_validate", "/admin/tf_validate", url.Values{"code": {prev}}).Code)
+
+	// recovery code only once
+	for _, expect := range []int{302, 401} {
+		c.post("/admin/", "/admin/logout", url.Values{})
+		c.post("/admin/login", "/admin/login", login)
+		w = c.post("/admin/tf_validate", "/admin/tf_validate", url.Values{"code": {recovery[0]}})
+		is.Equal(expect, w.Code)
+	}
+
+	// concurrent logins loaded the same codes, only one wins
+	var u1, u2 BaseUser
+	db.First(&u1, 1)
+	db.First(&u2, 1)
+	is.True(admin.Security().useRecoveryCode(&u1, recovery[1]))
+	is.False(admin.Security().useRecoveryCode(&u2, recovery[1]))
+}
+
+func TestTwoFactorReplace(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Security().CreateUser("alice@example.com", "secret")
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	secretOf := func(body string) string {
+		return regexp.MustCompile(`<code>([A-Z2-7]+)</code>`).FindStringSubmatch(body)[1]
+	}
+	// POST to the page just shown, GET makes a new secret
+	submit := func(page *httptest.ResponseRecorder, form url.Values) *httptest.ResponseRecorder {
+		form.Set("csrf_token", html.UnescapeString(csrfPattern.FindStringSubmatch(page.Body.String())[1]))
+		return c.do("POST", "/admin/tf_setup", form)
+	}
+	w := c.do("GET", "/admin/tf_setup", nil)
+	old := secretOf(w.Body.String())
+	code, _ := TotpCode(old, time.Now())
+	is.Contains(submit(w, url.Values{"action": {"setup"}, "code": {code}}).Body.String(), "recovery-codes")
+
+	// new secret alone does not replace the enrolled one
+	w = c.do("GET", "/admin/tf_setup", nil)
+	secret := secretOf(w.Body.String())
+	is.NotEqual(old, secret)
+	code, _ = TotpCode(secret, time.Now())
+	w = submit(w, url.Values{"action": {"setup"}, "code": {code}})
+	is.Contains(w.Body.String(), "Invalid code")
+	var u BaseUser
+	db.First(&u, 1)
+	is.Equal(old, u.TfTotpSecret)
+
+	current, _ := TotpCode(old, time.Now().Add(totpPeriod*time.Second))
+	w = submit(w, url.Values{"action": {"setup"}, "code": {code}, "code_current": {current}})
+	is.Contains(w.Body.String(), "recovery-codes")
+	db.First(&u, 1)
+	is.Equal(secret, u.TfTotpSecret)
+}
+
+func TestTwoFactorRequired(t *testing.T) {
+	is := assert.New(t)
+
+	admin, _ := newSecureAdmin(t)
+	admin.Security().SetTwoFactorRequired(true)
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w := c.do("GET", "/admin/", nil)
+	is.Equal(302, w.Code)
+	is.Equal("/admin/tf_setup", w.Header().Get("location"))
+	is.Equal(200, c.do("GET", "/admin/tf_setup", nil).Code)
+	is.Equal(302, c.post("/admin/tf_setup", "/admin/logout", url.Values{}).Code)
+}
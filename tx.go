@@ -0,0 +1,40 @@
+package gadm
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// transaction in context, by db of view
+type txKey struct{ db *gorm.DB }
+
+// Transaction of the current write, shared by hooks and actions.
+// Outside of a write, db of the view.
+func (V *ModelView) Tx(ctx context.Context) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{V.db}).(*gorm.DB); ok {
+		return tx
+	}
+	return V.db.WithContext(ctx)
+}
+
+// Run fn in transaction, a nested one joins the outer by savepoint.
+// Any error rolls back the whole operation.
+func (V *ModelView) transaction(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error) error {
+	return V.Tx(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, txKey{V.db}, tx), tx)
+	})
+}
+
+// Primary keys of the records exist, in url form
+func (V *ModelView) existing(tx *gorm.DB, rowids []string) ([]string, error) {
+	ss, err := V.snapshots(tx, rowids...)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(ss))
+	for i, s := range ss {
+		ids[i] = V.pkOf(s)
+	}
+	return ids, nil
+}
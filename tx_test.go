@@ -0,0 +1,100 @@
+package gadm
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTransaction(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	mv := NewModelView(Gadget{}, db)
+	mv.AddAction("restock", "Restock", "", func(ctx context.Context, ids []string) error {
+		for _, id := range ids {
+			if err := mv.Tx(ctx).Model(&Gadget{}).Where("id = ?", id).
+				Update("stock", 10).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).AddAction("broken", "Broken", "", func(ctx context.Context, ids []string) error {
+		for _, id := range ids {
+			mv.Tx(ctx).Model(&Gadget{}).Where("id = ?", id).Update("stock", 99)
+		}
+		return errors.New("out of stock")
+	}).AfterModelChange(func(ctx context.Context, row *Row, created bool) error {
+		if row.Get("name") == "Twin" {
+			mv.Tx(ctx).Create(&Gadget{Name: "Copy"})
+			return errors.New("no twins")
+		}
+		return nil
+	})
+	admin.AddView(mv)
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&[]Gadget{{Name: "Gear"}, {Name: "Cog"}})
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	stocks := func() (ss []int) {
+		db.Model(&Gadget{}).Order("id").Pluck("stock", &ss)
+		return
+	}
+
+	// missing records are not counted
+	c.post("/admin/gadget/", "/admin/gadget/action", url.Values{"action": {"restock"}, "rowid": {"1", "2", "9"}})
+	is.Contains(c.do("GET", "/admin/gadget/", nil).Body.String(), "Restock: 2 records were processed.")
+	is.Equal([]int{10, 10}, stocks())
+
+	// all or nothing
+	c.post("/admin/gadget/", "/admin/gadget/action", url.Values{"action": {"broken"}, "rowid": {"1", "2"}})
+	is.Contains(c.do("GET", "/admin/gadget/", nil).Body.String(), "out of stock")
+	is.Equal([]int{10, 10}, stocks())
+
+	// hook writes roll back with the record
+	w := c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"name": {"Twin"}})
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "Failed to create record. no twins")
+	is.Len(stocks(), 2)
+
+	c.post("/admin/gadget/", "/admin/gadget/action", url.Values{"action": {"delete"}, "rowid": {"1", "2", "9"}})
+	is.Contains(c.do("GET", "/admin/gadget/", nil).Body.String(), "2 records were successfully deleted.")
+	is.Len(stocks(), 0)
+}
+
+func TestNoRowsAffected(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	changed := 0
+	admin.AddView(NewModelView(Gadget{}, db).AfterModelChange(func(ctx context.Context, row *Row, created bool) error {
+		changed++
+		return nil
+	}))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+	db.Create(&Gadget{Name: "Gear"})
+
+	// like MySQL, unchanged row or ignored insert is 0 affected
+	db.Callback().Update().After("gorm:update").Register("test:none", func(tx *gorm.DB) { tx.RowsAffected = 0 })
+	db.Callback().Create().After("gorm:create").Register("test:none", func(tx *gorm.DB) { tx.RowsAffected = 0 })
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w := c.post("/admin/gadget/edit?id=1", "/admin/gadget/edit?id=1", url.Values{"name": {"Gear"}})
+	is.Equal(302, w.Code)
+	is.Equal(1, changed, "after hook of update")
+
+	w = c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"name": {"Cog"}})
+	is.Contains(w.Body.String(), "Failed to create record. Record was not created.")
+	is.Equal(1, changed)
+}
@@ -0,0 +1,156 @@
+package gadm
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm/schema"
+)
+
+// Check one submitted value, the error is shown under the field
+type Validator func(value string) error
+
+// Add custom validator of column, run after the ones from gorm tags
+func (V *ModelView) AddValidator(column string, validators ...Validator) *ModelView {
+	if V.column_validators == nil {
+		V.column_validators = map[string][]Validator{}
+	}
+	V.column_validators[column] = append(V.column_validators[column], validators...)
+	return V
+}
+
+// Error messages by db name
+type formErrors map[string][]string
+
+func (fe formErrors) add(name, msg string) { fe[name] = append(fe[name], msg) }
+
+// Validate submitted form of fields and inline children.
+// Missing fields are required only when creating.
+func (V *ModelView) validate(uv url.Values, fields []*Field, creating bool) formErrors {
+	errs := checkFields(uv, fields, creating, V.column_validators)
+	V.validateInlines(uv, errs)
+	return errs
+}
+
+func checkFields(uv url.Values, fields []*Field, creating bool, validators map[string][]Validator) formErrors {
+	errs := formErrors{}
+	for _, f := range fields {
+		if f.DBName == "" || f.Readonly || f.Hidden {
+			continue
+		}
+		if !uv.Has(f.DBName) {
+			if creating && required(f) {
+				errs.add(f.DBName, gettext("This field is required."))
+			}
+			continue
+		}
+
+		v := uv.Get(f.DBName)
+		if len(f.Choices) > 0 && v == "__None" {
+			v = ""
+		}
+		if strings.TrimSpace(v) == "" {
+			if required(f) {
+				errs.add(f.DBName, gettext("This field is required."))
+			}
+			continue
+		}
+
+		switch f.DataType {
+		case schema.Int:
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				errs.add(f.DBName, gettext("Not a valid integer value."))
+			}
+		case schema.Uint:
+			if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+				errs.add(f.DBName, gettext("Not a valid integer value."))
+			}
+		case schema.Float:
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				errs.add(f.DBName, gettext("Not a valid float value."))
+			}
+		case schema.String:
+			if f.Size > 0 && utf8.RuneCountInString(v) > f.Size {
+				errs.add(f.DBName, gettext("Field cannot be longer than %d characters.", f.Size))
+			}
+		case schema.Bool:
+			if _, err := strconv.ParseBool(v); err != nil {
+				errs.add(f.DBName, gettext("Not a valid boolean value."))
+			}
+		case schema.Time:
+			if !isTime(v) {
+				errs.add(f.DBName, gettext("Not a valid date or time value."))
+			}
+		default:
+			if isDecimal(f.DataType) && !decimalPattern.MatchString(v) {
+				errs.add(f.DBName, gettext("Not a valid decimal value."))
+			}
+		}
+
+		for _, fn := range validators[f.DBName] {
+			if err := fn(v); err != nil {
+				errs.add(f.DBName, err.Error())
+			}
+		}
+	}
+	return errs
+}
+
+// Layouts of date and time from the date pickers and the REST API
+var timeLayouts = []string{time.DateOnly, time.DateTime, "2006-01-02T15:04", "2006-01-02T15:04:05",
+	time.RFC3339Nano, time.TimeOnly}
+
+func isTime(v string) bool {
+	return slices.ContainsFunc(timeLayouts, func(layout string) bool {
+		_, err := time.Parse(layout, v)
+		return err == nil
+	})
+}
+
+// Plain number without exponent, to keep the precision of decimal
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+// not null without default, bool is false when missing
+func required(f *Field) bool {
+	return f.NotNull && !f.HasDefaultValue && !f.PrimaryKey && f.DataType != schema.Bool
+}
+
+// Column can be NULL, and so can the go type like *int or null.Int
+func nullable(f *Field) bool {
+	if f.NotNull || f.PrimaryKey {
+		return false
+	}
+	if f.FieldType.Kind() == reflect.Pointer {
+		return true
+	}
+	_, ok := reflect.New(f.FieldType).Interface().(sql.Scanner)
+	return ok
+}
+
+// First error, for x-editable
+func (fe formErrors) String() string {
+	for _, f := range slices.Sorted(maps.Keys(fe)) {
+		return fmt.Sprintf("%s: %s", f, fe[f][0])
+	}
+	return ""
+}
+
+// Row with submitted values, to render the form again
+func submitted(row *Row, uv url.Values) *Row {
+	fs := clone(row.Fields)
+	for _, f := range fs {
+		if (f.DBName != "" || f.Lookup != "") && !f.Readonly && uv.Has(f.FormName()) {
+			f.Value = uv.Get(f.FormName())
+		}
+	}
+	return &Row{Fields: fs, Map: map[string]any{}}
+}
@@ -0,0 +1,165 @@
+package gadm
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Gadget struct {
+	Id    uint   `gorm:"primaryKey;autoincrement"`
+	Name  string `gorm:"not null;size:8"`
+	Stock int
+	Price float64
+	Code  string
+}
+
+func TestValidate(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	admin.AddView(NewModelView(Gadget{}, db).
+		SetColumnEditableList("stock").
+		AddValidator("code", func(v string) error {
+			if strings.ToUpper(v) != v {
+				return errors.New("Code must be upper case.")
+			}
+			return nil
+		}))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	count := func() (n int64) {
+		db.Model(&Gadget{}).Count(&n)
+		return
+	}
+
+	// re-render with errors and submitted values
+	w := c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{
+		"name": {""}, "stock": {"abc"}, "price": {"1.5x"}, "code": {"ab"}})
+	is.Equal(200, w.Code)
+	body := w.Body.String()
+	is.Contains(body, "<li>This field is required.</li>")
+	is.Contains(body, "<li>Not a valid integer value.</li>")
+	is.Contains(body, "<li>Not a valid float value.</li>")
+	is.Contains(body, "<li>Code must be upper case.</li>")
+	is.Contains(body, `value="abc"`)
+	is.Contains(body, `value="1.5x"`)
+	is.Equal(int64(0), count())
+
+	// missing is required too
+	body = c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"code": {"AB"}}).Body.String()
+	is.Contains(body, "<li>This field is required.</li>")
+
+	body = c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"name": {"Sprocket-9"}}).Body.String()
+	is.Contains(body, "<li>Field cannot be longer than 8 characters.</li>")
+	is.Equal(int64(0), count())
+
+	w = c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{
+		"name": {"Sprocket"}, "stock": {"3"}, "price": {"1.5"}, "code": {"SP"}})
+	is.Equal(302, w.Code)
+	is.Equal(int64(1), count())
+
+	// edit keeps the record
+	w = c.post("/admin/gadget/edit?id=1", "/admin/gadget/edit?id=1", url.Values{"name": {"Gear"}, "stock": {"-"}})
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "<li>Not a valid integer value.</li>")
+	is.Contains(w.Body.String(), `value="Gear"`)
+	var g Gadget
+	db.First(&g, 1)
+	is.Equal("Sprocket", g.Name)
+	is.Equal(3, g.Stock)
+
+	is.Equal(302, c.post("/admin/gadget/edit?id=1", "/admin/gadget/edit?id=1", url.Values{"name": {"Gear"}}).Code)
+	db.First(&g, 1)
+	is.Equal("Gear", g.Name)
+
+	// x-editable
+	w = c.post("/admin/gadget/", "/admin/gadget/ajax/update", url.Values{"list_form_pk": {"1"}, "stock": {"many"}})
+	is.Equal(400, w.Code)
+	is.Equal("stock: Not a valid integer value.", w.Body.String())
+}
+
+func TestValidateCreateOnly(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	db.AutoMigrate(&Gadget{})
+	admin.AddView(NewModelView(Gadget{}, db).SetCanEdit(false))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w := c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"name": {"toolongname"}, "stock": {"abc"}})
+	is.Equal(200, w.Code)
+	is.Contains(w.Body.String(), "<li>Not a valid integer value.</li>")
+	is.Contains(w.Body.String(), "<li>Field cannot be longer than 8 characters.</li>")
+	is.NotContains(w.Body.String(), "readonly")
+	var n int64
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(0), n)
+
+	is.Equal(302, c.post("/admin/gadget/new", "/admin/gadget/new", url.Values{"name": {"gear"}, "stock": {"3"}}).Code)
+	db.Model(&Gadget{}).Count(&n)
+	is.Equal(int64(1), n)
+}
+
+type Delivery struct {
+	Id   uint
+	Due  time.Time
+	Fee  string `gorm:"type:decimal(10,2)"`
+	Paid bool
+}
+
+func TestValidateTypes(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.AddView(NewModelView(Delivery{}, db).SetColumnEditableList("due"))
+	admin.freeze()
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	w := c.post("/admin/delivery/new", "/admin/delivery/new", url.Values{
+		"due": {"2024-02-30"}, "fee": {"1e3"}, "paid": {"maybe"}})
+	is.Equal(200, w.Code)
+	body := w.Body.String()
+	is.Contains(body, "<li>Not a valid date or time value.</li>")
+	is.Contains(body, "<li>Not a valid decimal value.</li>")
+	is.Contains(body, "<li>Not a valid boolean value.</li>")
+	var n int64
+	db.Model(&Delivery{}).Count(&n)
+	is.Equal(int64(0), n)
+
+	for _, due := range []string{"2024-02-29", "2024-02-29 10:30:00", "2024-02-29T10:30", "2024-02-29T10:30:00Z"} {
+		is.Empty(checkFields(url.Values{"due": {due}}, NewModel(Delivery{}).Fields, false, nil), due)
+	}
+	for _, fee := range []string{"12", "-1.50", ".5", "3."} {
+		is.Empty(checkFields(url.Values{"fee": {fee}}, NewModel(Delivery{}).Fields, false, nil), fee)
+	}
+
+	w = c.post("/admin/delivery/new", "/admin/delivery/new", url.Values{
+		"due": {"2024-02-29"}, "fee": {"12.50"}, "paid": {"true"}})
+	is.Equal(302, w.Code)
+	var d Delivery
+	is.Nil(db.First(&d).Error)
+	is.True(d.Paid)
+	is.Equal(2024, d.Due.Year())
+
+	// x-editable
+	w = c.post("/admin/delivery/", "/admin/delivery/ajax/update", url.Values{"list_form_pk": {"1"}, "due": {"soon"}})
+	is.Equal(400, w.Code)
+	is.Equal("due: Not a valid date or time value.", w.Body.String())
+}
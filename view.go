@@ -7,10 +7,6 @@ import (
 	"strings"
 
 	"github.com/gorilla/csrf"
-	"github.com/samber/lo"
-	"github.com/spf13/cast"
-	"gorm.io/gorm"
-	"gorm.io/gorm/schema"
 )
 
 type View interface {
@@ -22,10 +18,10 @@ type View interface {
 
 	// Override this method if you want dynamically hide or show
 	// administrative views from Flask-Admin menu structure
-	IsVisible() bool
+	IsVisible(*http.Request) bool
 
 	// Override this method to add permission checks.
-	IsAccessible() bool
+	IsAccessible(*http.Request) bool
 
 	Render(http.ResponseWriter, *http.Request, string, template.FuncMap, map[string]any)
 
@@ -37,6 +33,9 @@ type BaseView struct {
 	Menu      Menu
 	admin     *Admin
 
+	// current user should have one of roles
+	roles []string
+
 	gt *groupTempl
 }
 
@@ -80,10 +79,18 @@ func (V *BaseView) Expose(path string, h http.HandlerFunc) {
 // 	return must(V.Blueprint.GetUrl(ep, queryToPairs(uv)...))
 // }
 
-func (V *BaseView) GetBlueprint() *Blueprint { return V.Blueprint }
-func (V *BaseView) GetMenu() *Menu           { return &V.Menu }
-func (V *BaseView) IsVisible() bool          { return true }
-func (V *BaseView) IsAccessible() bool       { return true }
+func (V *BaseView) GetBlueprint() *Blueprint       { return V.Blueprint }
+func (V *BaseView) GetMenu() *Menu                 { return &V.Menu }
+func (V *BaseView) IsVisible(r *http.Request) bool { return true }
+func (V *BaseView) IsAccessible(r *http.Request) bool {
+	return V.admin == nil || V.admin.security.HasRole(r, V.roles...)
+}
+
+// Only users with one of roles can access the view
+func (V *BaseView) SetAccessRoles(roles ...string) *BaseView {
+	V.roles = roles
+	return V
+}
 
 func (V *BaseView) Render(w http.ResponseWriter, r *http.Request, fn string, funcs template.FuncMap, data map[string]any) {
 	fm := V.admin.funcs(funcs)
@@ -114,7 +121,7 @@ func (V *BaseView) dict(r *http.Request, others ...map[string]any) map[string]an
 		"name":               V.Menu.Name,
 		"extra_css":          []string{},
 		"extra_js":           []string{}, // "a.js", "b.js"}
-		"admin":              V.admin.dict(),
+		"admin":              V.admin.dict(r),
 		"admin_fluid_layout": true,
 		"csrf_token":         func() string { return csrf.Token(r) },
 	}
@@ -158,81 +165,6 @@ type Action struct {
 	CSRFToken    string
 }
 
-type Filter struct {
-	Label      string     `json:"-"`
-	Arg        string     `json:"arg"`
-	Index      int        `json:"index"`     // 0-based
-	Operation  string     `json:"operation"` // equal, contains
-	Options    [][]string `json:"options"`
-	WidgetType *string    `json:"type"` // select2-tags/datetimepicker/null
-	DBName     string     `json:"-"`
-	Field      *Field     `json:"-"`
-}
-
-func (f *Filter) Apply(db *gorm.DB, q string) *gorm.DB {
-	switch f.Operation {
-	case "empty":
-		if q == "1" {
-			db = db.Where(f.DBName + " IS NULL")
-		} else {
-			db = db.Where(f.DBName + " IS NOT NULL")
-		}
-	case "like":
-		db = db.Where(f.DBName+" LIKE ?", like(q))
-	case "not like":
-		db = db.Where(f.DBName+" NOT LIKE ?", like(q))
-	case "equal":
-		if f.Field.DataType == schema.Bool {
-			db = db.Where(f.DBName+" = ?", f.qbool(q))
-		} else {
-			db = db.Where(f.DBName+" = ?", q)
-		}
-	case "not equal":
-		if f.Field.DataType == schema.Bool {
-			db = db.Where(f.DBName+" <> ?", f.qbool(q))
-		} else {
-			db = db.Where(f.DBName+" <> ?", q)
-		}
-	case "greater":
-		db = db.Where(f.DBName+" > ?", q)
-	case "smaller":
-		db = db.Where(f.DBName+" < ?", q)
-	case "in list":
-		db = db.Where(f.DBName+" IN ?", f.qlist(q))
-	case "not in list":
-		db = db.Where(f.DBName+" NOT IN ?", f.qlist(q))
-	case "between":
-		// 2025-11-19 00:00:00 to 2025-11-21 23:59:59
-		ts := f.qbetween(q)
-		db = db.Where(f.DBName+" BETWEEN ? AND ?", ts[0], ts[1])
-	case "not between":
-		ts := f.qbetween(q)
-		db = db.Where(f.DBName+" NOT BETWEEN ? AND ?", ts[0], ts[1])
-	}
-	return db
-}
-func (f *Filter) qbetween(q string) []string {
-	return strings.Split(q, " to ")
-}
-func (f *Filter) qbool(q string) bool {
-	return q == "1"
-}
-
-func (f *Filter) qlist(q string) any {
-	arr := strings.Split(q, ",")
-	switch f.Field.DataType {
-	case schema.String:
-		return arr
-	case schema.Int:
-		return lo.Map(arr, func(s string, _ int) int { return cast.ToInt(s) })
-	case schema.Uint:
-		return lo.Map(arr, func(s string, _ int) uint { return cast.ToUint(s) })
-	case schema.Float:
-		return lo.Map(arr, func(s string, _ int) float64 { return cast.ToFloat64(s) })
-	}
-	return arr
-}
-
 type InputFilter struct {
 	Label string
 	Index int
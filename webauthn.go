@@ -0,0 +1,731 @@
+package gadm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/spf13/cast"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Passkey of BaseUser
+type WebAuthnCredential struct {
+	Id     int    `gorm:"primaryKey"`
+	UserId int    `gorm:"index;not null"`
+	Name   string `gorm:"size:64"`
+	// base64url of raw credential id
+	CredentialId string `gorm:"uniqueIndex;not null;size:512"`
+	// COSE_Key
+	PublicKey  []byte `gorm:"not null"`
+	SignCount  uint32
+	CreatedAt  time.Time
+	LastUsedAt null.Time
+}
+
+var b64url = base64.RawURLEncoding
+
+// WebAuthn relying party
+type relyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Enable passkeys, rpID like "example.com", origins like "https://admin.example.com".
+// They are never taken from the Host of request, which a client or proxy can change.
+func (S *Security) SetWebAuthn(rpID, rpName string, origins ...string) *Security {
+	if S.rp == nil {
+		// in account menu before API tokens
+		account := S.Menu.find("Account")
+		i := slices.IndexFunc(account.Children, func(m *Menu) bool {
+			return m.Path == must(S.Blueprint.GetUrl("security.api_tokens"))
+		})
+		account.Children = slices.Insert(account.Children, max(i, 0), &Menu{Name: gettext("Passkeys"),
+			Path: must(S.Blueprint.GetUrl("security.wan_register"))})
+	}
+	S.rp = &relyingParty{ID: rpID, Name: rpName, Origins: origins}
+	return S
+}
+
+// Passkey routes are not found until SetWebAuthn
+func (S *Security) withWebAuthn(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if S.rp == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type credentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// PublicKeyCredentialCreationOptions, binary fields in base64url
+type creationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	Attestation            string                 `json:"attestation"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection map[string]string      `json:"authenticatorSelection"`
+}
+
+// PublicKeyCredentialRequestOptions, binary fields in base64url
+type requestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int                    `json:"timeout"`
+	UserVerification string                 `json:"userVerification"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+}
+
+// PublicKeyCredential from navigator.credentials, binary fields in base64url
+type publicKeyCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// COSE algorithms
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+func newChallenge() string {
+	bs := make([]byte, 32)
+	if _, err := rand.Read(bs); err != nil {
+		panic(err)
+	}
+	return b64url.EncodeToString(bs)
+}
+
+// Keep challenge in session, for one ceremony: webauthn.create or webauthn.get
+func (S *Security) saveChallenge(r *http.Request, ceremony string) string {
+	c := newChallenge()
+	sess := S.admin.Session(r)
+	sess.Values["wan_challenge"] = c
+	sess.Values["wan_ceremony"] = ceremony
+	return c
+}
+
+func (S *Security) popChallenge(r *http.Request, ceremony string) string {
+	sess := S.admin.Session(r)
+	c, _ := sess.Values["wan_challenge"].(string)
+	cc, _ := sess.Values["wan_ceremony"].(string)
+	delete(sess.Values, "wan_challenge")
+	delete(sess.Values, "wan_ceremony")
+	if cc != ceremony {
+		return ""
+	}
+	return c
+}
+
+// Verify clientDataJSON, return sha256 of it
+func (rp *relyingParty) verifyClientData(raw []byte, ceremony, challenge string) ([]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, err
+	}
+	if cd.Type != ceremony {
+		return nil, fmt.Errorf("unexpected type %s", cd.Type)
+	}
+	if challenge == "" ||
+		subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(challenge)) != 1 {
+		return nil, errors.New("challenge mismatch")
+	}
+	found := false
+	for _, o := range rp.Origins {
+		found = found || o == cd.Origin
+	}
+	if !found {
+		return nil, fmt.Errorf("unexpected origin %s", cd.Origin)
+	}
+	sum := sha256.Sum256(raw)
+	return sum[:], nil
+}
+
+// flags of authenticator data
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// attested credential data, only in registration
+	CredentialID []byte
+	PublicKey    []byte
+}
+
+func parseAuthenticatorData(bs []byte) (*authenticatorData, error) {
+	if len(bs) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		RPIDHash:  bs[:32],
+		Flags:     bs[32],
+		SignCount: binary.BigEndian.Uint32(bs[33:37]),
+	}
+	if ad.Flags&flagAttested != 0 {
+		rest := bs[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < n {
+			return nil, errors.New("credential id too short")
+		}
+		ad.CredentialID = rest[:n]
+
+		// COSE_Key, maybe followed by extensions
+		_, tail, err := cborDecode(rest[n:])
+		if err != nil {
+			return nil, err
+		}
+		ad.PublicKey = rest[n : len(rest)-len(tail)]
+	}
+	return ad, nil
+}
+
+func (rp *relyingParty) verifyAuthenticatorData(ad *authenticatorData) error {
+	hash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.RPIDHash, hash[:]) {
+		return errors.New("rp id mismatch")
+	}
+	if ad.Flags&flagUserPresent == 0 {
+		return errors.New("user not present")
+	}
+	return nil
+}
+
+// Verify registration response, attestation statement is not verified
+// since "none" attestation is requested.
+func (rp *relyingParty) finishRegistration(pkc *publicKeyCredential, challenge string) (*authenticatorData, error) {
+	cdj, err := b64url.DecodeString(pkc.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rp.verifyClientData(cdj, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	raw, err := b64url.DecodeString(pkc.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err := cborDecode(raw)
+	if err != nil {
+		return nil, err
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	authData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("invalid authenticator data")
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.CredentialID == nil {
+		return nil, errors.New("no attested credential")
+	}
+	if _, err := parseCOSEKey(ad.PublicKey); err != nil {
+		return nil, err
+	}
+	return ad, nil
+}
+
+// Verify assertion signature with stored credential, return new sign count
+func (rp *relyingParty) finishLogin(pkc *publicKeyCredential, challenge string, cred *WebAuthnCredential) (uint32, error) {
+	cdj, err := b64url.DecodeString(pkc.Response.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+	cdHash, err := rp.verifyClientData(cdj, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := b64url.DecodeString(pkc.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+	// passkey replaces password, so the user must be verified
+	if ad.Flags&flagUserVerified == 0 {
+		return 0, errors.New("user not verified")
+	}
+
+	sig, err := b64url.DecodeString(pkc.Response.Signature)
+	if err != nil {
+		return 0, err
+	}
+	key, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	if err := key.verify(append(authData, cdHash...), sig); err != nil {
+		return 0, err
+	}
+
+	// cloned authenticator
+	if ad.SignCount != 0 || cred.SignCount != 0 {
+		if ad.SignCount <= cred.SignCount {
+			return 0, errors.New("sign count is not increased")
+		}
+	}
+	return ad.SignCount, nil
+}
+
+type coseKey struct {
+	alg int
+	pub crypto.PublicKey
+}
+
+func parseCOSEKey(bs []byte) (*coseKey, error) {
+	v, _, err := cborDecode(bs)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("invalid COSE key")
+	}
+	kb := func(k int64) []byte { b, _ := m[k].([]byte); return b }
+
+	alg := cast.ToInt(m[int64(3)])
+	switch alg {
+	case coseES256:
+		x, y := kb(-2), kb(-3)
+		if cast.ToInt(m[int64(-1)]) != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("unsupported EC2 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(),
+			X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid EC2 point")
+		}
+		return &coseKey{alg, pub}, nil
+	case coseRS256:
+		n, e := kb(-1), kb(-2)
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("unsupported RSA key")
+		}
+		return &coseKey{alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64())}}, nil
+	case coseEdDSA:
+		x := kb(-2)
+		if cast.ToInt(m[int64(-1)]) != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported OKP key")
+		}
+		return &coseKey{alg, ed25519.PublicKey(x)}, nil
+	}
+	return nil, fmt.Errorf("unsupported COSE algorithm %d", alg)
+}
+
+func (k *coseKey) verify(data, sig []byte) error {
+	ok := false
+	switch pub := k.pub.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(pub, sum[:], sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, sig)
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// Minimal CBOR (RFC 8949) decoder for attestation object and COSE key.
+// Integer as int64, map as map[any]any, return left bytes.
+func cborDecode(bs []byte) (any, []byte, error) {
+	return cborDecodeDepth(bs, 0)
+}
+
+func cborDecodeDepth(bs []byte, depth int) (any, []byte, error) {
+	if depth > 16 {
+		return nil, nil, errors.New("cbor: too deep")
+	}
+	if len(bs) == 0 {
+		return nil, nil, errors.New("cbor: unexpected end")
+	}
+	major, info := bs[0]>>5, bs[0]&0x1f
+	bs = bs[1:]
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info == 24 && len(bs) >= 1:
+		n, bs = uint64(bs[0]), bs[1:]
+	case info == 25 && len(bs) >= 2:
+		n, bs = uint64(binary.BigEndian.Uint16(bs)), bs[2:]
+	case info == 26 && len(bs) >= 4:
+		n, bs = uint64(binary.BigEndian.Uint32(bs)), bs[4:]
+	case info == 27 && len(bs) >= 8:
+		n, bs = binary.BigEndian.Uint64(bs), bs[8:]
+	default:
+		return nil, nil, errors.New("cbor: unsupported length")
+	}
+
+	switch major {
+	case 0, 1:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		if major == 1 {
+			return -1 - int64(n), bs, nil
+		}
+		return int64(n), bs, nil
+	case 2, 3:
+		if uint64(len(bs)) < n {
+			return nil, nil, errors.New("cbor: unexpected end")
+		}
+		if major == 2 {
+			return bs[:n], bs[n:], nil
+		}
+		return string(bs[:n]), bs[n:], nil
+	case 4:
+		if n > uint64(len(bs)) {
+			return nil, nil, errors.New("cbor: unexpected end")
+		}
+		arr := make([]any, 0, n)
+		for range n {
+			var v any
+			var err error
+			if v, bs, err = cborDecodeDepth(bs, depth+1); err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, bs, nil
+	case 5:
+		if n > uint64(len(bs)) {
+			return nil, nil, errors.New("cbor: unexpected end")
+		}
+		m := make(map[any]any, n)
+		for range n {
+			var k, v any
+			var err error
+			if k, bs, err = cborDecodeDepth(bs, depth+1); err != nil {
+				return nil, nil, err
+			}
+			if v, bs, err = cborDecodeDepth(bs, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+				m[k] = v
+			default:
+				return nil, nil, errors.New("cbor: unsupported map key")
+			}
+		}
+		return m, bs, nil
+	case 7:
+		switch info {
+		case 20:
+			return false, bs, nil
+		case 21:
+			return true, bs, nil
+		case 22, 23:
+			return nil, bs, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+func readCredential(w http.ResponseWriter, r *http.Request) (*publicKeyCredential, error) {
+	var pkc publicKeyCredential
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&pkc); err != nil {
+		return nil, err
+	}
+	if pkc.Type != "public-key" || pkc.RawID == "" {
+		return nil, errors.New("invalid credential")
+	}
+	return &pkc, nil
+}
+
+// Random user handle, not changed with BaseUser.Uniquifier
+func (S *Security) userHandle(u *BaseUser) (string, error) {
+	if u.WebAuthnUserHandle == "" {
+		bs := make([]byte, 32)
+		if _, err := rand.Read(bs); err != nil {
+			return "", err
+		}
+		u.WebAuthnUserHandle = hex.EncodeToString(bs)
+		if err := S.db.Model(u).Update("web_authn_user_handle", u.WebAuthnUserHandle).Error; err != nil {
+			return "", err
+		}
+	}
+	return u.WebAuthnUserHandle, nil
+}
+
+// POST, creation options for navigator.credentials.create
+func (S *Security) wanRegisterOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	u := S.CurrentUser(r)
+	if u == nil || r.Method != http.MethodPost {
+		ReplyJson(w, http.StatusForbidden, map[string]any{"error": "forbidden"})
+		return
+	}
+
+	handle, err := S.userHandle(u)
+	if err != nil {
+		ReplyJson(w, http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return
+	}
+
+	rp := S.rp
+	var o creationOptions
+	o.Challenge = S.saveChallenge(r, "webauthn.create")
+	o.RP.ID, o.RP.Name = rp.ID, rp.Name
+	o.User.ID = b64url.EncodeToString([]byte(handle))
+	o.User.Name = u.Email
+	o.User.DisplayName = u.String()
+	for _, alg := range []int{coseES256, coseEdDSA, coseRS256} {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{"public-key", alg})
+	}
+	o.Timeout = 60000
+	o.Attestation = "none"
+	o.AuthenticatorSelection = map[string]string{
+		"residentKey":      "required",
+		"userVerification": "preferred",
+	}
+
+	var creds []WebAuthnCredential
+	S.db.Where("user_id = ?", u.Id).Find(&creds)
+	o.ExcludeCredentials = []credentialDescriptor{}
+	for _, c := range creds {
+		o.ExcludeCredentials = append(o.ExcludeCredentials, credentialDescriptor{"public-key", c.CredentialId})
+	}
+
+	ReplyJson(w, http.StatusOK, map[string]any{"publicKey": o})
+}
+
+// GET list passkeys of current user, POST json credential to register
+func (S *Security) wanRegisterHandler(w http.ResponseWriter, r *http.Request) {
+	u := S.CurrentUser(r)
+	if u == nil {
+		http.Redirect(w, r, must(S.Blueprint.GetUrl("security.login")), http.StatusFound)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		pkc, err := readCredential(w, r)
+		if err == nil {
+			var ad *authenticatorData
+			ad, err = S.rp.finishRegistration(pkc, S.popChallenge(r, "webauthn.create"))
+			if err == nil {
+				name := emptyOr(r.URL.Query().Get("name"), gettext("Passkey"))
+				err = S.db.Create(&WebAuthnCredential{
+					UserId:       u.Id,
+					Name:         name[:min(len(name), 64)],
+					CredentialId: b64url.EncodeToString(ad.CredentialID),
+					PublicKey:    ad.PublicKey,
+					SignCount:    ad.SignCount,
+				}).Error
+			}
+		}
+		if err != nil {
+			ReplyJson(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+			return
+		}
+		S.AddFlash(r, FlashSuccess(gettext("Passkey was successfully registered.")))
+		ReplyJson(w, http.StatusOK, map[string]any{
+			"location": must(S.Blueprint.GetUrl("security.wan_register"))})
+		return
+	}
+
+	var creds []WebAuthnCredential
+	S.db.Where("user_id = ?", u.Id).Order("id").Find(&creds)
+	S.Render(w, r, "templates/wan_register.gotmpl", nil, map[string]any{
+		"name":        gettext("Passkeys"),
+		"credentials": creds,
+		"options_url": must(S.Blueprint.GetUrl("security.wan_register_options")),
+		"finish_url":  must(S.Blueprint.GetUrl("security.wan_register")),
+		"delete_url":  must(S.Blueprint.GetUrl("security.wan_delete")),
+		"csrf_field":  csrf.TemplateField(r),
+		"csrf_token":  csrf.Token(r),
+	})
+}
+
+// POST id, remove a passkey of current user
+func (S *Security) wanDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	u := S.CurrentUser(r)
+	if u != nil && r.Method == http.MethodPost {
+		S.db.Where("user_id = ? AND id = ?", u.Id, r.PostFormValue("id")).
+			Delete(&WebAuthnCredential{})
+	}
+	http.Redirect(w, r, must(S.Blueprint.GetUrl("security.wan_register")), http.StatusFound)
+}
+
+// POST, request options for navigator.credentials.get, discoverable credential
+func (S *Security) wanSigninOptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !S.Enabled() || r.Method != http.MethodPost {
+		ReplyJson(w, http.StatusForbidden, map[string]any{"error": "forbidden"})
+		return
+	}
+
+	ReplyJson(w, http.StatusOK, map[string]any{"publicKey": requestOptions{
+		Challenge:        S.saveChallenge(r, "webauthn.get"),
+		RPID:             S.rp.ID,
+		Timeout:          60000,
+		UserVerification: "required",
+		AllowCredentials: []credentialDescriptor{},
+	}})
+}
+
+// POST json assertion, login without password, with the same lockout
+// and confirmation as password login
+func (S *Security) wanSigninHandler(w http.ResponseWriter, r *http.Request) {
+	fail := func(err error) {
+		ReplyJson(w, http.StatusUnauthorized, map[string]any{"error": err.Error()})
+	}
+	if !S.Enabled() || r.Method != http.MethodPost {
+		fail(errors.New("forbidden"))
+		return
+	}
+
+	ip, email := clientIp(r), ""
+	locked := func() bool {
+		if err := S.checkLockout(email, ip); err != nil {
+			ReplyJson(w, http.StatusTooManyRequests, map[string]any{"error": err.Error()})
+			return true
+		}
+		return false
+	}
+	if locked() {
+		return
+	}
+	failLogin := func(err error) {
+		S.failLogin(email, ip)
+		fail(err)
+	}
+
+	challenge := S.popChallenge(r, "webauthn.get")
+	pkc, err := readCredential(w, r)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	var cred WebAuthnCredential
+	var u BaseUser
+	if err := S.db.Where("credential_id = ?", pkc.RawID).First(&cred).Error; err != nil {
+		failLogin(errors.New(gettext("Unknown passkey")))
+		return
+	}
+	if err := S.db.First(&u, cred.UserId).Error; err != nil {
+		failLogin(errors.New(gettext("Unknown passkey")))
+		return
+	}
+	if email = u.Email; locked() {
+		return
+	}
+	if pkc.Response.UserHandle != "" {
+		handle, _ := b64url.DecodeString(pkc.Response.UserHandle)
+		if string(handle) != u.WebAuthnUserHandle {
+			failLogin(errors.New("user handle mismatch"))
+			return
+		}
+	}
+
+	count, err := S.rp.finishLogin(pkc, challenge, &cred)
+	if err != nil {
+		failLogin(err)
+		return
+	}
+	if !u.Active {
+		failLogin(errors.New(gettext("Account is disabled")))
+		return
+	}
+	if S.confirmable && !u.ConfirmedAt.Valid {
+		failLogin(errors.New(gettext("Email requires confirmation.")))
+		return
+	}
+	S.db.Model(&cred).Updates(map[string]any{
+		"sign_count":   count,
+		"last_used_at": time.Now(),
+	})
+
+	S.login(r, &u)
+	next := must(S.Blueprint.GetUrl("admin.index"))
+	if ref, err := url.Parse(r.Referer()); err == nil {
+		next = safeNext(ref.Query().Get("next"), next)
+	}
+	ReplyJson(w, http.StatusOK, map[string]any{"location": next})
+}
@@ -0,0 +1,359 @@
+package gadm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"html"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal CBOR encoder, for int64, string, []byte and map[any]any
+func cborEncode(v any) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 256:
+			return []byte{major<<5 | 24, byte(n)}
+		default:
+			bs := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(bs[1:], uint16(n))
+			return bs
+		}
+	}
+	switch v := v.(type) {
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case map[any]any:
+		bs := head(5, uint64(len(v)))
+		for k, x := range v {
+			bs = append(bs, cborEncode(k)...)
+			bs = append(bs, cborEncode(x)...)
+		}
+		return bs
+	}
+	panic("unsupported")
+}
+
+// Software authenticator with one ES256 discoverable credential
+type softAuthenticator struct {
+	origin string
+	key    *ecdsa.PrivateKey
+	id     []byte
+	handle []byte
+	count  uint32
+	// without user verification, like a security key without pin
+	unverified bool
+}
+
+func newSoftAuthenticator(origin string) *softAuthenticator {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{origin: origin, key: key, id: id}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	bs, _ := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: a.origin})
+	return bs
+}
+
+func (a *softAuthenticator) authData(rpID string, attested bool) []byte {
+	a.count++
+	hash := sha256.Sum256([]byte(rpID))
+	bs := append([]byte{}, hash[:]...)
+	flags := byte(flagUserPresent | flagUserVerified)
+	if a.unverified {
+		flags &^= flagUserVerified
+	}
+	if attested {
+		flags |= flagAttested
+	}
+	bs = append(bs, flags)
+	bs = binary.BigEndian.AppendUint32(bs, a.count)
+	if attested {
+		bs = append(bs, make([]byte, 16)...) // aaguid
+		bs = binary.BigEndian.AppendUint16(bs, uint16(len(a.id)))
+		bs = append(bs, a.id...)
+		bs = append(bs, cborEncode(map[any]any{
+			int64(1):  int64(2),
+			int64(3):  int64(coseES256),
+			int64(-1): int64(1),
+			int64(-2): a.key.X.FillBytes(make([]byte, 32)),
+			int64(-3): a.key.Y.FillBytes(make([]byte, 32)),
+		})...)
+	}
+	return bs
+}
+
+func (a *softAuthenticator) create(options []byte) []byte {
+	var o struct{ PublicKey creationOptions }
+	json.Unmarshal(options, &o)
+	a.handle, _ = b64url.DecodeString(o.PublicKey.User.ID)
+
+	var pkc publicKeyCredential
+	pkc.ID = b64url.EncodeToString(a.id)
+	pkc.RawID, pkc.Type = pkc.ID, "public-key"
+	pkc.Response.ClientDataJSON = b64url.EncodeToString(a.clientData("webauthn.create", o.PublicKey.Challenge))
+	pkc.Response.AttestationObject = b64url.EncodeToString(cborEncode(map[any]any{
+		"fmt":      "none",
+		"attStmt":  map[any]any{},
+		"authData": a.authData(o.PublicKey.RP.ID, true),
+	}))
+	bs, _ := json.Marshal(pkc)
+	return bs
+}
+
+func (a *softAuthenticator) get(options []byte) []byte {
+	var o struct{ PublicKey requestOptions }
+	json.Unmarshal(options, &o)
+
+	cdj := a.clientData("webauthn.get", o.PublicKey.Challenge)
+	ad := a.authData(o.PublicKey.RPID, false)
+	sum := sha256.Sum256(cdj)
+	digest := sha256.Sum256(append(append([]byte{}, ad...), sum[:]...))
+	sig, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+
+	var pkc publicKeyCredential
+	pkc.ID = b64url.EncodeToString(a.id)
+	pkc.RawID, pkc.Type = pkc.ID, "public-key"
+	pkc.Response.ClientDataJSON = b64url.EncodeToString(cdj)
+	pkc.Response.AuthenticatorData = b64url.EncodeToString(ad)
+	pkc.Response.Signature = b64url.EncodeToString(sig)
+	pkc.Response.UserHandle = b64url.EncodeToString(a.handle)
+	bs, _ := json.Marshal(pkc)
+	return bs
+}
+
+var dataTokenPattern = regexp.MustCompile(`data-token="([^"]+)"`)
+
+// csrf token for ajax in the page
+func (c *testClient) token(page string) string {
+	w := c.do("GET", page, nil)
+	if m := dataTokenPattern.FindStringSubmatch(w.Body.String()); m != nil {
+		return html.UnescapeString(m[1])
+	}
+	return ""
+}
+
+func (c *testClient) postJSON(path, token string, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", path, bytes.NewReader(body))
+	r.Header.Set("content-type", "application/json")
+	r.Header.Set("X-CSRF-Token", token)
+	for _, ck := range c.cookies {
+		r.AddCookie(ck)
+	}
+	w := httptest.NewRecorder()
+	c.h.ServeHTTP(w, r)
+	for _, ck := range w.Result().Cookies() {
+		c.cookies[ck.Name] = ck
+	}
+	return w
+}
+
+func TestCbor(t *testing.T) {
+	is := assert.New(t)
+
+	v, rest, err := cborDecode(append(cborEncode(map[any]any{
+		"a": int64(-300), int64(1): []byte{1, 2}}), 0xff))
+	is.Nil(err)
+	is.Equal([]byte{0xff}, rest)
+	is.Equal(map[any]any{"a": int64(-300), int64(1): []byte{1, 2}}, v)
+
+	_, _, err = cborDecode([]byte{0x5a, 0xff, 0xff, 0xff, 0xff})
+	is.NotNil(err)
+}
+
+// Decoder of untrusted input never panics or reads past the end
+func FuzzCborDecode(f *testing.F) {
+	f.Add(cborEncode(map[any]any{"a": int64(-300), int64(1): []byte{1, 2}}))
+	f.Add([]byte{0x82, 0x63, 0x66, 0x6d, 0x74, 0xa0})
+	f.Add([]byte{0x9f, 0xff})
+	f.Add([]byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		if _, rest, err := cborDecode(bs); err == nil && len(rest) > len(bs) {
+			t.Fatalf("rest %d longer than input %d", len(rest), len(bs))
+		}
+	})
+}
+
+func FuzzParseAuthenticatorData(f *testing.F) {
+	a := newSoftAuthenticator("https://example.com")
+	f.Add(a.authData("example.com", true))
+	f.Add(a.authData("example.com", false))
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		if ad, err := parseAuthenticatorData(bs); err == nil && ad.Flags&flagAttested != 0 {
+			parseCOSEKey(ad.PublicKey)
+		}
+	})
+}
+
+func FuzzParseCOSEKey(f *testing.F) {
+	a := newSoftAuthenticator("https://example.com")
+	ad, _ := parseAuthenticatorData(a.authData("example.com", true))
+	f.Add(ad.PublicKey)
+	f.Add(cborEncode(map[any]any{int64(1): int64(3), int64(3): int64(coseRS256), int64(-1): []byte{1}, int64(-2): []byte{3}}))
+	f.Fuzz(func(t *testing.T, bs []byte) {
+		if k, err := parseCOSEKey(bs); err == nil {
+			k.verify([]byte("data"), []byte("sig"))
+		}
+	})
+}
+
+func TestWebAuthn(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Security().SetWebAuthn("example.com", "Test", "https://example.com")
+	u, _ := admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	w := c.post("/admin/login", "/admin/login", url.Values{
+		"email": {"alice@example.com"}, "password": {"secret"}})
+	is.Equal(302, w.Code)
+
+	// register
+	auth := newSoftAuthenticator("https://example.com")
+	token := c.token("/admin/wan_register")
+	w = c.postJSON("/admin/wan_register_options", token, nil)
+	is.Equal(200, w.Code)
+	w = c.postJSON("/admin/wan_register?name=Laptop", token, auth.create(w.Body.Bytes()))
+	is.Equal(200, w.Code, w.Body.String())
+
+	var cred WebAuthnCredential
+	is.Nil(db.First(&cred).Error)
+	is.Equal(u.Id, cred.UserId)
+	is.Equal("Laptop", cred.Name)
+	is.Equal(uint32(1), cred.SignCount)
+	is.Contains(c.do("GET", "/admin/wan_register", nil).Body.String(), "Laptop")
+
+	// challenge is used once
+	w = c.postJSON("/admin/wan_register", token, auth.create([]byte(`{}`)))
+	is.Equal(400, w.Code)
+
+	// login with passkey
+	c2 := newTestClient(admin)
+	is.Equal(302, c2.do("GET", "/admin/", nil).Code)
+	token = c2.token("/admin/login")
+	is.Equal(403, c2.postJSON("/admin/wan_signin_options", "", nil).Code, "csrf")
+
+	w = c2.postJSON("/admin/wan_signin_options", token, nil)
+	is.Equal(200, w.Code)
+	options := w.Body.Bytes()
+
+	// wrong origin
+	evil := *auth
+	evil.origin = "https://evil.com"
+	is.Equal(401, c2.postJSON("/admin/wan_signin", token, evil.get(options)).Code)
+
+	w = c2.postJSON("/admin/wan_signin_options", token, nil)
+	options = w.Body.Bytes()
+	w = c2.postJSON("/admin/wan_signin", token, auth.get(options))
+	is.Equal(200, w.Code, w.Body.String())
+	is.Contains(w.Body.String(), `"location":"/admin/"`)
+	is.Equal(200, c2.do("GET", "/admin/", nil).Code)
+
+	// replayed assertion
+	c3 := newTestClient(admin)
+	token = c3.token("/admin/login")
+	w = c3.postJSON("/admin/wan_signin_options", token, nil)
+	is.Equal(401, c3.postJSON("/admin/wan_signin", token, auth.get(options)).Code)
+
+	// cloned authenticator, sign count goes back
+	w = c3.postJSON("/admin/wan_signin_options", token, nil)
+	clone := *auth
+	clone.count = 0
+	is.Equal(401, c3.postJSON("/admin/wan_signin", token, clone.get(w.Body.Bytes())).Code)
+
+	// removed
+	w = c.post("/admin/wan_register", "/admin/wan_delete", url.Values{"id": {"1"}})
+	is.Equal(302, w.Code)
+	w = c3.postJSON("/admin/wan_signin_options", token, nil)
+	is.Equal(401, c3.postJSON("/admin/wan_signin", token, auth.get(w.Body.Bytes())).Code)
+}
+
+func TestWebAuthnGates(t *testing.T) {
+	is := assert.New(t)
+
+	admin, db := newSecureAdmin(t)
+	admin.Security().SetWebAuthn("example.com", "Test", "https://example.com").
+		SetLockout(2, 9, time.Minute)
+	admin.Security().CreateUser("alice@example.com", "secret")
+
+	c := newTestClient(admin)
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+	auth := newSoftAuthenticator("https://example.com")
+	token := c.token("/admin/wan_register")
+	w := c.postJSON("/admin/wan_register_options", token, nil)
+	is.Equal(200, c.postJSON("/admin/wan_register?name=Key", token, auth.create(w.Body.Bytes())).Code)
+
+	signin := func(a *softAuthenticator) *httptest.ResponseRecorder {
+		c := newTestClient(admin)
+		token := c.token("/admin/login")
+		w := c.postJSON("/admin/wan_signin_options", token, nil)
+		is.Contains(w.Body.String(), `"userVerification":"required"`)
+		return c.postJSON("/admin/wan_signin", token, a.get(w.Body.Bytes()))
+	}
+
+	// user verification is required
+	auth.unverified = true
+	w = signin(auth)
+	is.Equal(401, w.Code)
+	is.Contains(w.Body.String(), "user not verified")
+	auth.unverified = false
+
+	// unconfirmed email
+	admin.Security().SetConfirmable(true)
+	w = signin(auth)
+	is.Equal(401, w.Code)
+	is.Contains(w.Body.String(), "Email requires confirmation.")
+	admin.Security().SetConfirmable(false)
+
+	// account is locked after failures, by password or passkey
+	w = signin(auth)
+	is.Equal(429, w.Code)
+	is.Contains(w.Body.String(), "Too many failed login attempts")
+
+	db.Where("1 = 1").Delete(&LoginLockout{})
+	is.Equal(200, signin(auth).Code)
+}
+
+func TestWebAuthnDisabled(t *testing.T) {
+	is := assert.New(t)
+
+	admin, _ := newSecureAdmin(t)
+	admin.Security().CreateUser("alice@example.com", "secret")
+	c := newTestClient(admin)
+	is.NotContains(c.do("GET", "/admin/login", nil).Body.String(), "Log in with a passkey")
+	c.post("/admin/login", "/admin/login", url.Values{"email": {"alice@example.com"}, "password": {"secret"}})
+
+	// relying party is not taken from Host of request
+	is.NotContains(c.do("GET", "/admin/", nil).Body.String(), "Passkeys")
+	is.Equal(404, c.do("GET", "/admin/wan_register", nil).Code)
+	token := html.UnescapeString(csrfPattern.FindStringSubmatch(c.do("GET", "/admin/api_tokens", nil).Body.String())[1])
+	is.Equal(404, c.postJSON("/admin/wan_register_options", token, nil).Code)
+	is.Equal(404, c.postJSON("/admin/wan_signin_options", token, nil).Code)
+
+	admin.Security().SetWebAuthn("example.com", "Test", "https://example.com")
+	body := c.do("GET", "/admin/", nil).Body.String()
+	is.Regexp(`(?s)/admin/tf_setup.*/admin/wan_register.*/admin/api_tokens`, body)
+	is.Equal(200, c.do("GET", "/admin/wan_register", nil).Code)
+}